@@ -0,0 +1,136 @@
+package electrum
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// Batch queues calls to different methods to be sent together, each call resolves its own
+// Future once the batch is sent. Batches are split automatically at 'MaxBatchSize' calls
+//
+//	batch := client.NewBatch()
+//	balance := batch.ScriptHashBalance(scriptHash)
+//	history := batch.ScriptHashHistory(scriptHash)
+//	if err := batch.Send(ctx); err != nil { ... }
+//	b, err := balance.Result()
+type Batch struct {
+	c     *Client
+	mu    sync.Mutex
+	reqs  []*request
+	calls []resolver
+}
+
+// Calls queued in a batch, resolved with their response
+type resolver interface {
+	resolve(res *response, err error)
+}
+
+// Future holds the result of a call queued in a batch
+type Future[T any] struct {
+	method string
+	done   chan struct{}
+	result T
+	err    error
+}
+
+// NewBatch returns an empty batch of calls
+func (c *Client) NewBatch() *Batch {
+	return &Batch{c: c}
+}
+
+// Queue adds a call of an arbitrary method to the batch, its result is decoded into T
+func Queue[T any](b *Batch, method string, params ...any) *Future[T] {
+	f := &Future[T]{method: method, done: make(chan struct{})}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.reqs = append(b.reqs, b.c.req(method, params...))
+	b.calls = append(b.calls, f)
+	return f
+}
+
+// Len returns the number of calls queued
+func (b *Batch) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.reqs)
+}
+
+// Send dispatches the queued calls and resolves their futures, even when failing to
+// send them. The batch is emptied and can be reused afterwards
+func (b *Batch) Send(ctx context.Context) error {
+	b.mu.Lock()
+	reqs, calls := b.reqs, b.calls
+	b.reqs, b.calls = nil, nil
+	b.mu.Unlock()
+
+	if len(reqs) == 0 {
+		return nil
+	}
+
+	res, err := b.c.syncBatches(ctx, reqs)
+	for i, call := range calls {
+		if err != nil {
+			call.resolve(nil, err)
+		} else {
+			call.resolve(res[i], nil)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("error sending batch: %w", err)
+	}
+	return nil
+}
+
+func (f *Future[T]) resolve(res *response, err error) {
+	if err == nil {
+		err = decodeValue(res, &f.result)
+	}
+	if err != nil {
+		f.err = fmt.Errorf("error calling %s: %w", f.method, err)
+	}
+	close(f.done)
+}
+
+// Done is closed once the call is resolved
+func (f *Future[T]) Done() <-chan struct{} {
+	return f.done
+}
+
+// Result returns the outcome of the call, blocking until its batch is sent
+func (f *Future[T]) Result() (T, error) {
+	<-f.done
+	return f.result, f.err
+}
+
+// ScriptHashBalance queues a 'blockchain.scripthash.get_balance' call
+func (b *Batch) ScriptHashBalance(scriptHash string) *Future[*Balance] {
+	return Queue[*Balance](b, "blockchain.scripthash.get_balance", scriptHash)
+}
+
+// ScriptHashHistory queues a 'blockchain.scripthash.get_history' call
+func (b *Batch) ScriptHashHistory(scriptHash string) *Future[[]Tx] {
+	return Queue[[]Tx](b, "blockchain.scripthash.get_history", scriptHash)
+}
+
+// ScriptHashMempool queues a 'blockchain.scripthash.get_mempool' call
+func (b *Batch) ScriptHashMempool(scriptHash string) *Future[[]MempoolTx] {
+	return Queue[[]MempoolTx](b, "blockchain.scripthash.get_mempool", scriptHash)
+}
+
+// ScriptHashListUnspent queues a 'blockchain.scripthash.listunspent' call
+func (b *Batch) ScriptHashListUnspent(scriptHash string) *Future[[]UnspentTx] {
+	return Queue[[]UnspentTx](b, "blockchain.scripthash.listunspent", scriptHash)
+}
+
+// TransactionMerkle queues a 'blockchain.transaction.get_merkle' call
+func (b *Batch) TransactionMerkle(tx string, height int) *Future[*TxMerkle] {
+	return Queue[*TxMerkle](b, "blockchain.transaction.get_merkle", tx, strconv.Itoa(height))
+}
+
+// VerboseTransaction queues a verbose 'blockchain.transaction.get' call
+func (b *Batch) VerboseTransaction(hash string) *Future[*VerboseTx] {
+	return Queue[*VerboseTx](b, "blockchain.transaction.get", hash, true)
+}
@@ -0,0 +1,79 @@
+package electrum
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestBatch(t *testing.T) {
+	client := newMockClient(t, &Options{MaxBatchSize: 2}, func(method string, params []json.RawMessage) (any, *RPCError) {
+		switch method {
+		case "blockchain.scripthash.get_balance":
+			return &Balance{Confirmed: 10}, nil
+		case "blockchain.scripthash.get_history":
+			return []Tx{{Hash: "aa", Height: 1}}, nil
+		case "blockchain.scripthash.listunspent":
+			return []UnspentTx{{Tx: Tx{Hash: "aa"}, Value: 10}}, nil
+		case "blockchain.transaction.get_merkle":
+			return &TxMerkle{BlockHeight: 1, Pos: 3}, nil
+		case "blockchain.transaction.get", "blockchain.scripthash.subscribe":
+			return json.RawMessage("null"), nil
+		}
+		return nil, &RPCError{Code: 2, Message: "daemon error"}
+	})
+
+	batch := client.NewBatch()
+	balance := batch.ScriptHashBalance("a")
+	history := batch.ScriptHashHistory("a")
+	unspent := batch.ScriptHashListUnspent("a")
+	merkle := batch.TransactionMerkle("aa", 1)
+	failed := Queue[string](batch, "unknown")
+	missing := batch.VerboseTransaction("bb")
+	status := Queue[*string](batch, "blockchain.scripthash.subscribe", "a")
+	if batch.Len() != 7 {
+		t.Fatalf("unexpected batch length: %d", batch.Len())
+	}
+
+	if err := batch.Send(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if batch.Len() != 0 {
+		t.Error("expected the batch to be emptied")
+	}
+
+	if b, err := balance.Result(); err != nil || b.Confirmed != 10 {
+		t.Errorf("unexpected balance %+v: %v", b, err)
+	}
+	if h, err := history.Result(); err != nil || len(h) != 1 || h[0].Hash != "aa" {
+		t.Errorf("unexpected history %+v: %v", h, err)
+	}
+	if u, err := unspent.Result(); err != nil || len(u) != 1 || u[0].Value != 10 {
+		t.Errorf("unexpected unspent %+v: %v", u, err)
+	}
+	if m, err := merkle.Result(); err != nil || m.Pos != 3 {
+		t.Errorf("unexpected merkle %+v: %v", m, err)
+	}
+	if _, err := failed.Result(); !errors.Is(err, ErrDaemonError) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// Null objects are reported as missing, other values may be null
+	if tx, err := missing.Result(); tx != nil || !errors.Is(err, ErrMissingResponse) {
+		t.Errorf("unexpected transaction %+v: %v", tx, err)
+	}
+	if s, err := status.Result(); s != nil || err != nil {
+		t.Errorf("unexpected status %v: %v", s, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	pending := batch.ScriptHashBalance("b")
+	if err := batch.Send(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := pending.Result(); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the future to be resolved with the error, got %v", err)
+	}
+}
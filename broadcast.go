@@ -0,0 +1,157 @@
+package electrum
+
+import (
+	"fmt"
+	"strings"
+)
+
+// BroadcastReason categorizes why a broadcast transaction was rejected
+type BroadcastReason int
+
+// Broadcast rejection reasons
+const (
+	// Rejected for a reason not covered by the other categories
+	BroadcastRejected BroadcastReason = iota
+
+	// The transaction is already confirmed
+	BroadcastAlreadyInChain
+
+	// Some of the outputs spent are unknown or already spent
+	BroadcastMissingInputs
+
+	// The fee doesn't meet the mempool minimum or doesn't cover a replacement
+	BroadcastFeeTooLow
+
+	// The fee rate is below the minimum relay fee
+	BroadcastMinRelayFee
+
+	// The transaction violates the standardness policy
+	BroadcastNonStandard
+
+	// The transaction spends outputs already spent by a mempool transaction
+	BroadcastMempoolConflict
+)
+
+func (r BroadcastReason) String() string {
+	switch r {
+	case BroadcastAlreadyInChain:
+		return "already in chain"
+	case BroadcastMissingInputs:
+		return "missing inputs"
+	case BroadcastFeeTooLow:
+		return "fee too low"
+	case BroadcastMinRelayFee:
+		return "min relay fee not met"
+	case BroadcastNonStandard:
+		return "non-standard"
+	case BroadcastMempoolConflict:
+		return "mempool conflict"
+	}
+	return "rejected"
+}
+
+// Reject reasons reported by bitcoind, and the error messages of its broadcast RPC,
+// identifying each reason
+var broadcastReasons = map[string]BroadcastReason{
+	"transaction already in block chain":      BroadcastAlreadyInChain,
+	"transaction outputs already in utxo set": BroadcastAlreadyInChain,
+	"txn-already-confirmed":                   BroadcastAlreadyInChain,
+	"txn-mempool-conflict":                    BroadcastMempoolConflict,
+	"bad-txns-inputs-missingorspent":          BroadcastMissingInputs,
+	"missing-inputs":                          BroadcastMissingInputs,
+	"missing inputs":                          BroadcastMissingInputs,
+	"inputs missing or spent":                 BroadcastMissingInputs,
+	"min relay fee not met":                   BroadcastMinRelayFee,
+	"mempool min fee not met":                 BroadcastFeeTooLow,
+	"insufficient fee":                        BroadcastFeeTooLow,
+	"version":                                 BroadcastNonStandard,
+	"tx-size":                                 BroadcastNonStandard,
+	"tx-size-small":                           BroadcastNonStandard,
+	"scriptsig-size":                          BroadcastNonStandard,
+	"scriptsig-not-pushonly":                  BroadcastNonStandard,
+	"scriptpubkey":                            BroadcastNonStandard,
+	"bare-multisig":                           BroadcastNonStandard,
+	"dust":                                    BroadcastNonStandard,
+	"multi-op-return":                         BroadcastNonStandard,
+	"non-mandatory-script-verify-flag":        BroadcastNonStandard,
+	"bad-txns-nonstandard-inputs":             BroadcastNonStandard,
+	"bad-witness-nonstandard":                 BroadcastNonStandard,
+	"txn-already-in-mempool":                  BroadcastRejected,
+	"txn-already-known":                       BroadcastRejected,
+	"non-final":                               BroadcastRejected,
+	"non-bip68-final":                         BroadcastRejected,
+	"too-long-mempool-chain":                  BroadcastRejected,
+	"mandatory-script-verify-flag-failed":     BroadcastRejected,
+	"replacement-adds-unconfirmed":            BroadcastRejected,
+	"too many potential replacements":         BroadcastRejected,
+	"absurdly-high-fee":                       BroadcastRejected,
+	"max-fee-exceeded":                        BroadcastRejected,
+	"fee exceeds maximum configured by user":  BroadcastRejected,
+}
+
+// Find the reject reason within a daemon rejection message. Servers wrap the daemon
+// message, one line of it holds the reason, optionally followed by details after a comma
+// or in parentheses, e.g. 'min relay fee not met, 100 < 141'. Consensus failures, all
+// prefixed by 'bad-txns-', are recognized as well
+func rejectReason(msg string) (BroadcastReason, bool) {
+	for _, line := range strings.Split(msg, "\n") {
+		token := strings.ToLower(strings.TrimSpace(line))
+		if i := strings.LastIndex(token, ": "); i >= 0 {
+			token = token[i+2:]
+		}
+		if i := strings.IndexAny(token, ",("); i >= 0 {
+			token = strings.TrimSpace(token[:i])
+		}
+		if reason, ok := broadcastReasons[token]; ok {
+			return reason, true
+		}
+		if strings.HasPrefix(token, "bad-txns-") && !strings.ContainsRune(token, ' ') {
+			return BroadcastRejected, true
+		}
+	}
+	return BroadcastRejected, false
+}
+
+// BroadcastError describes why the server rejected a transaction; it matches
+// ErrRejectedTx, as well as the RPCError reported by the server if any
+type BroadcastError struct {
+	Reason  BroadcastReason
+	Message string
+	Err     error
+}
+
+func (e *BroadcastError) Error() string {
+	return fmt.Sprintf("transaction rejected (%s): %s", e.Reason, e.Message)
+}
+
+func (e *BroadcastError) Unwrap() []error {
+	if e.Err == nil {
+		return []error{ErrRejectedTx}
+	}
+	return []error{ErrRejectedTx, e.Err}
+}
+
+// Classify a rejection message relayed by the server; reasons not recognized are
+// reported as BroadcastRejected
+func newBroadcastError(msg string, err error) *BroadcastError {
+	reason, _ := rejectReason(msg)
+	return &BroadcastError{Reason: reason, Message: msg, Err: err}
+}
+
+// Wrapper ElectrumX adds to the messages of transactions rejected by the daemon
+const networkRulesRejection = "rejected by network rules"
+
+// Reports whether an error replying to a broadcast is a daemon rejection: servers report
+// them with either the bad request or the daemon error code, and the message must either
+// be wrapped as a rejection or hold a known reject reason. Other errors, e.g. a busy
+// server, don't say anything about the transaction itself
+func isRejection(err *RPCError) bool {
+	if err.Code != codeBadRequest && err.Code != codeDaemonError {
+		return false
+	}
+	if strings.Contains(strings.ToLower(err.Message), networkRulesRejection) {
+		return true
+	}
+	_, ok := rejectReason(err.Message)
+	return ok
+}
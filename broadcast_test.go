@@ -0,0 +1,78 @@
+package electrum
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestBroadcastTransaction(t *testing.T) {
+	client := newMockClient(t, nil, func(method string, params []json.RawMessage) (any, *RPCError) {
+		var hex string
+		_ = json.Unmarshal(params[0], &hex)
+		switch {
+		case hex == "ok":
+			return "abcd", nil
+		case hex == "legacy":
+			return "the transaction was rejected by network rules.\n\nmissing-inputs\n[ok]", nil
+		case hex == "null":
+			return nil, nil
+		case strings.HasPrefix(hex, "busy"):
+			return nil, &RPCError{Code: -102, Message: hex}
+		case strings.HasPrefix(hex, "daemon"):
+			return nil, &RPCError{Code: 2, Message: strings.TrimPrefix(hex, "daemon ")}
+		}
+		return nil, &RPCError{Code: 1, Message: "the transaction was rejected by network rules.\n\n" + hex + "\n[" + hex + "]"}
+	})
+
+	if txID, err := client.BroadcastTransaction("ok"); err != nil || txID != "abcd" {
+		t.Errorf("unexpected result %q: %v", txID, err)
+	}
+
+	cases := map[string]BroadcastReason{
+		"Transaction already in block chain":         BroadcastAlreadyInChain,
+		"Transaction outputs already in utxo set":    BroadcastAlreadyInChain,
+		"bad-txns-inputs-missingorspent":             BroadcastMissingInputs,
+		"legacy":                                     BroadcastMissingInputs,
+		"min relay fee not met, 100 < 141":           BroadcastMinRelayFee,
+		"mempool min fee not met, 1000 < 2000":       BroadcastFeeTooLow,
+		"insufficient fee, rejecting replacement aa": BroadcastFeeTooLow,
+		"dust": BroadcastNonStandard,
+		"non-mandatory-script-verify-flag (Signature must be zero)": BroadcastNonStandard,
+		"txn-mempool-conflict":   BroadcastMempoolConflict,
+		"bad-txns-vout-negative": BroadcastRejected,
+		"daemon mandatory-script-verify-flag-failed (Invalid signature)": BroadcastRejected,
+		"daemon error: too-long-mempool-chain, too many descendants":     BroadcastRejected,
+
+		// Rejections wrapped by the server match even when the reason is unknown
+		"unsupported version 3": BroadcastRejected,
+		"stardust":              BroadcastRejected,
+	}
+	for hex, reason := range cases {
+		_, err := client.BroadcastTransaction(hex)
+		var broadcastErr *BroadcastError
+		if !errors.As(err, &broadcastErr) || broadcastErr.Reason != reason {
+			t.Errorf("%s: expected %s, got %v", hex, reason, err)
+		}
+		if !errors.Is(err, ErrRejectedTx) {
+			t.Errorf("%s: expected a rejection, got %v", hex, err)
+		}
+	}
+
+	_, err := client.BroadcastTransaction("dust")
+	if !errors.Is(err, ErrBadRequest) {
+		t.Errorf("expected the server error to be preserved, got %v", err)
+	}
+
+	// Server failures and daemon errors without a known reason aren't rejections
+	for _, hex := range []string{"busy dust", "busy rejected by network rules", "daemon connection refused", "daemon stardust", "null"} {
+		_, err := client.BroadcastTransaction(hex)
+		if err == nil || errors.Is(err, ErrRejectedTx) {
+			t.Errorf("%s: expected a server error, got %v", hex, err)
+		}
+	}
+	if _, err := client.BroadcastTransaction("busy"); !errors.Is(err, ErrServerBusy) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package electrum
+
+import (
+	"context"
+	"fmt"
+)
+
+// ScriptHashBalances gets the balances of many scripthashes at once, using as few batches
+// as 'MaxBatchSize' allows. Results are keyed by scripthash, a failure to retrieve one
+// balance doesn't affect the rest
+func (c *Client) ScriptHashBalances(ctx context.Context, scriptHashes []string) (map[string]CallResult[*Balance], error) {
+	return scriptHashBatch[*Balance](ctx, c, "blockchain.scripthash.get_balance", "balance", scriptHashes)
+}
+
+// ScriptHashListUnspents gets the unspent outputs of many scripthashes at once, as
+// 'ScriptHashBalances' does
+func (c *Client) ScriptHashListUnspents(ctx context.Context, scriptHashes []string) (map[string]CallResult[[]UnspentTx], error) {
+	return scriptHashBatch[[]UnspentTx](ctx, c, "blockchain.scripthash.listunspent", "listunspent", scriptHashes)
+}
+
+// ScriptHashHistories gets the histories of many scripthashes at once, as
+// 'ScriptHashBalances' does. When 'CacheHistories' is enabled the statuses are requested
+// first, and only the histories not cached or changed since are retrieved
+func (c *Client) ScriptHashHistories(ctx context.Context, scriptHashes []string) (map[string]CallResult[[]Tx], error) {
+	if !c.cacheHistories {
+		return scriptHashBatch[[]Tx](ctx, c, "blockchain.scripthash.get_history", "history", scriptHashes)
+	}
+
+	statuses, err := scriptHashBatch[*string](ctx, c, "blockchain.scripthash.subscribe", "history", scriptHashes)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(map[string]CallResult[[]Tx], len(statuses))
+	var fetch []string
+	for scriptHash, r := range statuses {
+		if r.Err != nil {
+			results[scriptHash] = CallResult[[]Tx]{Err: r.Err}
+			continue
+		}
+		if list, ok := c.loadHistory(scriptHash, statusOf(r.Result)); ok {
+			results[scriptHash] = CallResult[[]Tx]{Result: list}
+			continue
+		}
+		fetch = append(fetch, scriptHash)
+	}
+
+	fetched, err := scriptHashBatch[[]Tx](ctx, c, "blockchain.scripthash.get_history", "history", fetch)
+	if err != nil {
+		return nil, err
+	}
+	for scriptHash, r := range fetched {
+		if r.Err == nil {
+			c.storeHistory(scriptHash, statusOf(statuses[scriptHash].Result), r.Result)
+		}
+		results[scriptHash] = r
+	}
+	return results, nil
+}
+
+// Status reported for a scripthash, null when it has no history
+func statusOf(status *string) string {
+	if status == nil {
+		return ""
+	}
+	return *status
+}
+
+// Run a scripthash method for many scripthashes, duplicates are requested only once
+func scriptHashBatch[T any](ctx context.Context, c *Client, method, what string, scriptHashes []string) (map[string]CallResult[T], error) {
+	results := make(map[string]CallResult[T], len(scriptHashes))
+	params := make([][]any, 0, len(scriptHashes))
+	unique := make([]string, 0, len(scriptHashes))
+	for _, scriptHash := range scriptHashes {
+		if _, ok := results[scriptHash]; ok {
+			continue
+		}
+		results[scriptHash] = CallResult[T]{}
+		params = append(params, []any{scriptHash})
+		unique = append(unique, scriptHash)
+	}
+	if len(params) == 0 {
+		return results, nil
+	}
+
+	res, err := c.syncBatches(ctx, c.batchReq(method, params))
+	if err != nil {
+		return nil, fmt.Errorf("error getting %s for %d scripthashes: %w", what, len(unique), err)
+	}
+
+	for i, scriptHash := range unique {
+		var r CallResult[T]
+		if err := decodeValue(res[i], &r.Result); err != nil {
+			r.Err = fmt.Errorf("error getting %s for scripthash %s: %w", what, scriptHash, err)
+		}
+		results[scriptHash] = r
+	}
+	return results, nil
+}
@@ -0,0 +1,87 @@
+package electrum
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestScriptHashBulk(t *testing.T) {
+	var mu sync.Mutex
+	calls := map[string]int{}
+	histories := map[string][]Tx{
+		"a": {{Hash: "aa", Height: 1}},
+		"b": {{Hash: "bb", Height: 2}, {Hash: "cc", Height: 0}},
+	}
+	client := newMockClient(t, &Options{MaxBatchSize: 2, CacheHistories: true}, func(method string, params []json.RawMessage) (any, *RPCError) {
+		var scriptHash string
+		_ = json.Unmarshal(params[0], &scriptHash)
+		mu.Lock()
+		defer mu.Unlock()
+		calls[method]++
+		switch scriptHash {
+		case "bad":
+			return nil, &RPCError{Code: 1, Message: "invalid scripthash"}
+		case "null":
+			return json.RawMessage("null"), nil
+		}
+		switch method {
+		case "blockchain.scripthash.get_balance":
+			return &Balance{Confirmed: int64(len(scriptHash))}, nil
+		case "blockchain.scripthash.listunspent":
+			return []UnspentTx{{Value: 5}}, nil
+		case "blockchain.scripthash.subscribe":
+			if len(histories[scriptHash]) == 0 {
+				return nil, nil
+			}
+			return historyStatus(histories[scriptHash]), nil
+		case "blockchain.scripthash.get_history":
+			return histories[scriptHash], nil
+		}
+		return nil, &RPCError{Code: -32601, Message: "unknown method"}
+	})
+	ctx := context.Background()
+	scriptHashes := []string{"a", "bb", "bad", "a", "ccc"}
+
+	balances, err := client.ScriptHashBalances(ctx, scriptHashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(balances) != 4 || balances["bb"].Result.Confirmed != 2 || balances["ccc"].Result.Confirmed != 3 {
+		t.Errorf("unexpected balances: %+v", balances)
+	}
+	if !errors.Is(balances["bad"].Err, ErrBadRequest) {
+		t.Errorf("unexpected error: %v", balances["bad"].Err)
+	}
+	if calls["blockchain.scripthash.get_balance"] != 4 {
+		t.Errorf("expected duplicates to be requested once, got %d requests", calls["blockchain.scripthash.get_balance"])
+	}
+
+	// Null objects are reported as missing rather than returned as nil
+	balances, err = client.ScriptHashBalances(ctx, []string{"null"})
+	if err != nil || balances["null"].Result != nil || !errors.Is(balances["null"].Err, ErrMissingResponse) {
+		t.Errorf("unexpected null balance %+v: %v", balances["null"], err)
+	}
+
+	unspents, err := client.ScriptHashListUnspents(ctx, []string{"a"})
+	if err != nil || len(unspents["a"].Result) != 1 || unspents["a"].Result[0].Value != 5 {
+		t.Errorf("unexpected unspents %+v: %v", unspents, err)
+	}
+
+	for i := 0; i < 2; i++ {
+		list, err := client.ScriptHashHistories(ctx, []string{"a", "b", "c", "bad"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := fmt.Sprint(len(list["a"].Result), len(list["b"].Result), len(list["c"].Result), list["bad"].Err != nil)
+		if got != "1 2 0 true" {
+			t.Errorf("unexpected histories: %+v", list)
+		}
+	}
+	if n := calls["blockchain.scripthash.get_history"]; n != 3 {
+		t.Errorf("expected cached histories to be reused, got %d requests", n)
+	}
+}
@@ -3,111 +3,641 @@ package electrum
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	_ "github.com/glebarez/go-sqlite"
 )
 
+// Cache stores transactions retrieved from the server, either verbose (VerboseTx) or
+// enriched (RichTx) ones. Once an enriched entry is stored for a transaction it takes
+// precedence over verbose entries, and loading into a *RichTx only succeeds for
+// enriched entries
+type Cache interface {
+	// Store the transaction (VerboseTx or RichTx, by value or reference)
+	Store(txID string, tx any) error
+
+	// Load a transaction into the provided value, reports whether an entry was found
+	Load(txID string, tx any) bool
+
+	// StoreMany stores many transactions at once, by txid
+	StoreMany(txs map[string]any) error
+
+	// LoadMany loads the verbose details of many transactions at once, returns the
+	// entries found by txid
+	LoadMany(txIDs []string) map[string]*VerboseTx
+
+	// StoreItem stores an auxiliary value (merkle proof, header, history...) of the given
+	// kind, associated with the height of the block it depends on
+	StoreItem(kind, key string, height int64, item any) error
+
+	// LoadItem loads an auxiliary value into the provided value, reports whether an
+	// entry was found
+	LoadItem(kind, key string, item any) bool
+
+	// Remove deletes a transaction, if cached
+	Remove(txID string) error
+
+	// PurgeAbove removes all the entries included in blocks above the given height,
+	// used when those blocks are no longer part of the active chain
+	PurgeAbove(height int64) error
+
+	// Close releases the resources used by the cache
+	Close() error
+}
+
+// NoCache disables transactions caching
+var NoCache Cache = nopCache{}
+
+type nopCache struct{}
+
+func (nopCache) Store(string, any) error                    { return nil }
+func (nopCache) Load(string, any) bool                      { return false }
+func (nopCache) StoreMany(map[string]any) error             { return nil }
+func (nopCache) LoadMany([]string) map[string]*VerboseTx    { return nil }
+func (nopCache) StoreItem(string, string, int64, any) error { return nil }
+func (nopCache) LoadItem(string, string, any) bool          { return false }
+func (nopCache) Remove(string) error                        { return nil }
+func (nopCache) PurgeAbove(int64) error                     { return nil }
+func (nopCache) Close() error                               { return nil }
+
+const (
+	// Number of stores between checks of the cache size limits
+	evictionInterval = 100
+
+	// Maximum number of rows written or read by a single bulk statement
+	maxBulkRows = 100
+
+	// How long a connection waits for a database locked by another process
+	busyTimeout = 5 * time.Second
+
+	// Minimum time between updates of the access time of an entry, so most lookups
+	// don't require a write
+	touchInterval = time.Minute
+)
+
+// Statement inserting transactions, followed by the values of each row
+const insertTxs = "INSERT INTO tx_cache (txid, tx, is_detailed, block_hash, height, version, last_access) VALUES "
+
+// Conflict clause of 'insertTxs', detailed entries are never replaced by verbose ones
+const upsertTxs = `
+	ON CONFLICT(txid) DO UPDATE SET
+		tx = excluded.tx,
+		is_detailed = excluded.is_detailed,
+		block_hash = excluded.block_hash,
+		height = excluded.height,
+		version = excluded.version,
+		last_access = excluded.last_access
+	WHERE is_detailed = 0 OR version != excluded.version`
+
+// Placeholders of a single row of 'insertTxs'
+const txRowValues = "(?, ?, ?, ?, ?, ?, ?)"
+
+// TxCache is a Cache backed by a sqlite database. The database runs in WAL mode: reads
+// proceed concurrently, while writes are serialized by the cache
 type TxCache struct {
 	mu sync.Mutex
 	db *sql.DB
+
+	storeStmt     *sql.Stmt
+	loadStmt      *sql.Stmt
+	touchStmt     *sql.Stmt
+	storeItemStmt *sql.Stmt
+	loadItemStmt  *sql.Stmt
+	touchItemStmt *sql.Stmt
+
+	maxEntries int64
+	maxBytes   int64
+	stores     int
+
+	// Clock used for access times, replaced in tests
+	now func() time.Time
+
+	verboseHits    atomic.Uint64
+	verboseMisses  atomic.Uint64
+	detailedHits   atomic.Uint64
+	detailedMisses atomic.Uint64
+	itemHits       atomic.Uint64
+	itemMisses     atomic.Uint64
+	evictedEntries atomic.Uint64
 }
 
+// TxCacheOptions define the limits of a sqlite cache; once exceeded, the least
+// recently accessed entries are evicted
+type TxCacheOptions struct {
+	// Maximum number of cached transactions and auxiliary items, unlimited if zero
+	MaxEntries int64
+
+	// Maximum size in bytes of the cached transactions and auxiliary items, unlimited
+	// if zero
+	MaxBytes int64
+}
+
+// CacheCounters register the lookups for a kind of cache entry
+type CacheCounters struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+}
+
+// CacheStats report the usage and effectiveness of a cache
+type CacheStats struct {
+	Verbose   CacheCounters `json:"verbose"`
+	Detailed  CacheCounters `json:"detailed"`
+	Items     CacheCounters `json:"items"`
+	Evictions uint64        `json:"evictions"`
+	Entries   int64         `json:"entries"`
+	Bytes     int64         `json:"bytes"`
+}
+
+// NewTxCache returns an unbounded sqlite cache, using the 'tx_cache.db' file of the
+// working directory if no database is provided
 func NewTxCache(db *sql.DB) (*TxCache, error) {
-	if db == nil {
+	return NewTxCacheWithOptions(db, nil)
+}
+
+// NewTxCacheWithOptions returns a sqlite cache enforcing the provided limits. Databases
+// provided by the caller are switched to WAL mode, and should set a busy timeout when
+// shared with other processes
+func NewTxCacheWithOptions(db *sql.DB, options *TxCacheOptions) (*TxCache, error) {
+	owned := db == nil
+	if owned {
 		var err error
-		db, err = sql.Open("sqlite", "tx_cache.db")
+		db, err = sql.Open("sqlite", fmt.Sprintf("tx_cache.db?_pragma=busy_timeout(%d)", busyTimeout.Milliseconds()))
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	_, err := db.Exec(`
-	CREATE TABLE IF NOT EXISTS tx_cache (
-		txid VARCHAR(64) PRIMARY KEY,
-		tx TEXT,
-		is_detailed INTEGER DEFAULT 0
-	)
-	`)
-	if err != nil {
+	if options == nil {
+		options = &TxCacheOptions{}
+	}
+
+	// Only the database opened here is closed on failure, not the caller's
+	fail := func(err error) (*TxCache, error) {
+		if owned {
+			err = errors.Join(err, db.Close())
+		}
 		return nil, err
 	}
-	return &TxCache{db: db}, nil
+
+	if _, err := db.Exec("PRAGMA journal_mode = WAL"); err != nil {
+		return fail(fmt.Errorf("error enabling WAL mode: %w", err))
+	}
+	if err := migrate(db); err != nil {
+		return fail(err)
+	}
+
+	c := &TxCache{
+		db:         db,
+		maxEntries: options.MaxEntries,
+		maxBytes:   options.MaxBytes,
+		now:        time.Now,
+	}
+	if err := c.prepare(); err != nil {
+		_ = c.closeStmts()
+		return fail(err)
+	}
+	return c, nil
+}
+
+// Prepare the statements used by every lookup and store
+func (c *TxCache) prepare() error {
+	stmts := []struct {
+		stmt  **sql.Stmt
+		query string
+	}{
+		{&c.storeStmt, insertTxs + txRowValues + upsertTxs},
+		{&c.loadStmt, "SELECT tx, is_detailed, version, last_access FROM tx_cache WHERE txid = ?"},
+		{&c.touchStmt, "UPDATE tx_cache SET last_access = ? WHERE txid = ?"},
+		{&c.storeItemStmt, `INSERT INTO cache_items (kind, key, value, height, version, last_access) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(kind, key) DO UPDATE SET
+			value = excluded.value,
+			height = excluded.height,
+			version = excluded.version,
+			last_access = excluded.last_access`},
+		{&c.loadItemStmt, "SELECT value, version, last_access FROM cache_items WHERE kind = ? AND key = ?"},
+		{&c.touchItemStmt, "UPDATE cache_items SET last_access = ? WHERE kind = ? AND key = ?"},
+	}
+	for _, s := range stmts {
+		stmt, err := c.db.Prepare(s.query)
+		if err != nil {
+			return fmt.Errorf("error preparing cache statement: %w", err)
+		}
+		*s.stmt = stmt
+	}
+	return nil
+}
+
+func (c *TxCache) closeStmts() error {
+	var errs []error
+	for _, stmt := range []*sql.Stmt{c.storeStmt, c.loadStmt, c.touchStmt, c.storeItemStmt, c.loadItemStmt, c.touchItemStmt} {
+		if stmt != nil {
+			errs = append(errs, stmt.Close())
+		}
+	}
+	return errors.Join(errs...)
 }
 
 func (c *TxCache) Close() error {
+	err := c.closeStmts()
 	if c.db != nil {
-		return c.db.Close()
+		return errors.Join(err, c.db.Close())
 	}
-	return nil
+	return err
 }
 
-func (c *TxCache) Store(txID string, tx any) error {
+// Values of the 'insertTxs' row storing a transaction
+func txRow(txID string, tx any, now int64) ([]any, error) {
 	b, err := json.Marshal(tx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	isDetailed := 0
-	switch tx.(type) {
-	case *RichTx:
-		isDetailed = 1
-	case RichTx:
+	if isRichTx(tx) {
 		isDetailed = 1
 	}
+	blockHash, height := txBlock(tx)
+	return []any{txID, string(b), isDetailed, blockHash, height, cacheModelVersion, now}, nil
+}
+
+func (c *TxCache) Store(txID string, tx any) error {
+	row, err := txRow(txID, tx, c.now().UnixMilli())
+	if err != nil {
+		return err
+	}
 
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	_, err = c.db.Exec(
-		`INSERT INTO tx_cache (txid, tx, is_detailed) VALUES (?, ?, ?)
-		ON CONFLICT(txid) WHERE is_detailed = 0 DO UPDATE SET
-			tx = ?,
-			is_detailed = ?`,
-		txID,
-		string(b[:]),
-		isDetailed,
-		string(b[:]),
-		isDetailed,
-	)
+	if _, err := c.storeStmt.Exec(row...); err != nil {
+		return err
+	}
+	return c.stored(1)
+}
+
+// StoreMany stores the transactions using multi-row inserts within a single database
+// transaction
+func (c *TxCache) StoreMany(txs map[string]any) error {
+	if len(txs) == 0 {
+		return nil
+	}
+
+	now := c.now().UnixMilli()
+	rows := make([][]any, 0, len(txs))
+	for txID, tx := range txs {
+		row, err := txRow(txID, tx, now)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, row)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	dbTx, err := c.db.Begin()
 	if err != nil {
 		return err
 	}
+	defer func() { _ = dbTx.Rollback() }()
+
+	for start := 0; start < len(rows); start += maxBulkRows {
+		chunk := rows[start:min(start+maxBulkRows, len(rows))]
+		values := make([]string, len(chunk))
+		args := make([]any, 0, len(chunk)*len(chunk[0]))
+		for i, row := range chunk {
+			values[i] = txRowValues
+			args = append(args, row...)
+		}
+		if _, err := dbTx.Exec(insertTxs+strings.Join(values, ", ")+upsertTxs, args...); err != nil {
+			return err
+		}
+	}
+
+	if err := dbTx.Commit(); err != nil {
+		return err
+	}
+	return c.stored(len(rows))
+}
 
+// Register stored entries, checking the size limits every 'evictionInterval' stores;
+// must be called while holding the lock
+func (c *TxCache) stored(n int) error {
+	before := c.stores
+	c.stores += n
+	if c.stores/evictionInterval != before/evictionInterval {
+		return c.evict()
+	}
 	return nil
 }
 
+// Load a transaction into the provided value, registering the lookup in the cache
+// statistics and the access time of the entry, at most once every 'touchInterval'
 func (c *TxCache) Load(txID string, tx any) bool {
+	_, detailed := tx.(*RichTx)
+	hits, misses := &c.verboseHits, &c.verboseMisses
+	if detailed {
+		hits, misses = &c.detailedHits, &c.detailedMisses
+	}
+
+	lastAccess, ok := c.load(txID, tx)
+	if !ok {
+		misses.Add(1)
+		return false
+	}
+	hits.Add(1)
+
+	now := c.now()
+	if !stale(lastAccess, now) {
+		return true
+	}
 	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := c.touchStmt.Exec(now.UnixMilli(), txID)
+	return err == nil
+}
 
-	row, err := c.db.Query(
-		"SELECT tx, is_detailed FROM tx_cache WHERE txid = ?",
-		txID,
-	)
+// Read an entry and its access time; the row is consumed before returning, and WAL mode
+// allows reading while another connection writes, so no lock is required
+func (c *TxCache) load(txID string, tx any) (int64, bool) {
+	var data []byte
+	var isDetailed, version int
+	var lastAccess int64
+	if err := c.loadStmt.QueryRow(txID).Scan(&data, &isDetailed, &version, &lastAccess); err != nil {
+		return 0, false
+	}
 
-	c.mu.Unlock()
+	// Entries serialized with a different data model are stale
+	if version != cacheModelVersion {
+		return 0, false
+	}
 
+	if _, ok := tx.(*RichTx); ok && isDetailed == 0 {
+		return 0, false
+	}
+	return lastAccess, json.Unmarshal(data, tx) == nil
+}
+
+// Reports whether an access time, in milliseconds, is due to be updated
+func stale(lastAccess int64, now time.Time) bool {
+	return now.UnixMilli()-lastAccess >= touchInterval.Milliseconds()
+}
+
+// LoadMany loads the verbose details of the transactions with a query per 'maxBulkRows'
+// transactions, registering the lookups and access times like 'Load'
+func (c *TxCache) LoadMany(txIDs []string) map[string]*VerboseTx {
+	txs := make(map[string]*VerboseTx, len(txIDs))
+	var touched []any
+
+	now := c.now()
+	for start := 0; start < len(txIDs); start += maxBulkRows {
+		chunk := txIDs[start:min(start+maxBulkRows, len(txIDs))]
+		rows, err := c.db.Query(
+			"SELECT txid, tx, version, last_access FROM tx_cache WHERE txid IN ("+placeholders(len(chunk))+")",
+			anySlice(chunk)...,
+		)
+		if err != nil {
+			continue
+		}
+		for rows.Next() {
+			var txID string
+			var data []byte
+			var version int
+			var lastAccess int64
+			if rows.Scan(&txID, &data, &version, &lastAccess) != nil || version != cacheModelVersion {
+				continue
+			}
+			tx := new(VerboseTx)
+			if json.Unmarshal(data, tx) == nil {
+				txs[txID] = tx
+				if stale(lastAccess, now) {
+					touched = append(touched, txID)
+				}
+			}
+		}
+		_ = rows.Close()
+	}
+
+	c.verboseHits.Add(uint64(len(txs)))
+	c.verboseMisses.Add(uint64(len(txIDs) - len(txs)))
+	if len(touched) == 0 {
+		return txs
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for start := 0; start < len(touched); start += maxBulkRows {
+		chunk := touched[start:min(start+maxBulkRows, len(touched))]
+		_, _ = c.db.Exec(
+			"UPDATE tx_cache SET last_access = ? WHERE txid IN ("+placeholders(len(chunk))+")",
+			append([]any{now.UnixMilli()}, chunk...)...,
+		)
+	}
+	return txs
+}
+
+// StoreItem stores an auxiliary value, replacing any previous entry with the same key
+func (c *TxCache) StoreItem(kind, key string, height int64, item any) error {
+	b, err := json.Marshal(item)
 	if err != nil {
-		return false
+		return err
 	}
-	defer row.Close()
-	if !row.Next() {
-		return false
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, err := c.storeItemStmt.Exec(kind, key, string(b), height, cacheModelVersion, c.now().UnixMilli()); err != nil {
+		return err
 	}
+	return c.stored(1)
+}
+
+// LoadItem loads an auxiliary value into the provided value, registering the lookup in
+// the cache statistics and the access time of the entry like 'Load'
+func (c *TxCache) LoadItem(kind, key string, item any) bool {
 	var data []byte
-	var isDetailed int
-	err = row.Scan(&data, &isDetailed)
-	if err != nil {
+	var version int
+	var lastAccess int64
+	err := c.loadItemStmt.QueryRow(kind, key).Scan(&data, &version, &lastAccess)
+	if err != nil || version != cacheModelVersion || json.Unmarshal(data, item) != nil {
+		c.itemMisses.Add(1)
 		return false
 	}
+	c.itemHits.Add(1)
 
-	switch tx.(type) {
-	case *RichTx:
-		if isDetailed == 0 {
-			return false
+	now := c.now()
+	if !stale(lastAccess, now) {
+		return true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err = c.touchItemStmt.Exec(now.UnixMilli(), kind, key)
+	return err == nil
+}
+
+// Comma separated list of 'n' query placeholders
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func anySlice[T any](values []T) []any {
+	s := make([]any, len(values))
+	for i, v := range values {
+		s[i] = v
+	}
+	return s
+}
+
+// Stats returns the lookup counters and current size of the cache
+func (c *TxCache) Stats() (CacheStats, error) {
+	stats := CacheStats{
+		Verbose: CacheCounters{
+			Hits:   c.verboseHits.Load(),
+			Misses: c.verboseMisses.Load(),
+		},
+		Detailed: CacheCounters{
+			Hits:   c.detailedHits.Load(),
+			Misses: c.detailedMisses.Load(),
+		},
+		Items: CacheCounters{
+			Hits:   c.itemHits.Load(),
+			Misses: c.itemMisses.Load(),
+		},
+		Evictions: c.evictedEntries.Load(),
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	err := c.db.QueryRow(
+		`SELECT
+			(SELECT COUNT(*) FROM tx_cache) + (SELECT COUNT(*) FROM cache_items),
+			(SELECT COALESCE(SUM(LENGTH(tx)), 0) FROM tx_cache) + (SELECT COALESCE(SUM(LENGTH(value)), 0) FROM cache_items)`,
+	).Scan(&stats.Entries, &stats.Bytes)
+	return stats, err
+}
+
+// Prune removes the entries not accessed within the provided duration, returns the
+// number of entries removed
+func (c *TxCache) Prune(olderThan time.Duration) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var removed int64
+	for _, table := range []string{"tx_cache", "cache_items"} {
+		res, err := c.db.Exec(
+			"DELETE FROM "+table+" WHERE last_access < ?",
+			c.now().Add(-olderThan).UnixMilli(),
+		)
+		if err != nil {
+			return removed, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return removed, err
 		}
+		removed += n
 	}
-	err = json.Unmarshal(data, tx)
+	return removed, nil
+}
 
-	return err == nil
+// Remove the least recently accessed entries exceeding the size limits; must be
+// called while holding the lock
+func (c *TxCache) evict() error {
+	if c.maxEntries <= 0 && c.maxBytes <= 0 {
+		return nil
+	}
+
+	maxEntries, maxBytes := c.maxEntries, c.maxBytes
+	if maxEntries <= 0 {
+		maxEntries = math.MaxInt64
+	}
+	if maxBytes <= 0 {
+		maxBytes = math.MaxInt64
+	}
+
+	dbTx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = dbTx.Rollback() }()
+
+	// Both tables are ranked together; removing the evicted transactions only shifts
+	// the rank of entries that are evicted as well
+	var evicted int64
+	for _, query := range []string{
+		"DELETE FROM tx_cache WHERE txid IN (SELECT id FROM evicted WHERE item = 0)",
+		"DELETE FROM cache_items WHERE (kind, key) IN (SELECT kind, id FROM evicted WHERE item = 1)",
+	} {
+		res, err := dbTx.Exec(rankedEntries+query, maxEntries, maxBytes)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		evicted += n
+	}
+
+	if err := dbTx.Commit(); err != nil {
+		return err
+	}
+	c.evictedEntries.Add(uint64(evicted))
+	return nil
+}
+
+// Rank the transactions and auxiliary items by recency, selecting the entries
+// exceeding the limits as 'evicted'
+const rankedEntries = `WITH entries AS (
+	SELECT 0 AS item, '' AS kind, txid AS id, LENGTH(tx) AS size, last_access FROM tx_cache
+	UNION ALL
+	SELECT 1, kind, key, LENGTH(value), last_access FROM cache_items
+), evicted AS (
+	SELECT item, kind, id FROM (
+		SELECT
+			item, kind, id,
+			ROW_NUMBER() OVER recent AS entries,
+			SUM(size) OVER recent AS bytes
+		FROM entries
+		WINDOW recent AS (ORDER BY last_access DESC, item, kind, id)
+	)
+	WHERE entries > ? OR bytes > ?
+)
+`
+
+// Remove deletes a transaction, if cached
+func (c *TxCache) Remove(txID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, err := c.db.Exec("DELETE FROM tx_cache WHERE txid = ?", txID)
+	return err
+}
+
+// PurgeAbove removes the entries included in blocks above the given height
+func (c *TxCache) PurgeAbove(height int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, err := c.db.Exec("DELETE FROM tx_cache WHERE height > ?", height); err != nil {
+		return err
+	}
+	_, err := c.db.Exec("DELETE FROM cache_items WHERE height > ?", height)
+	return err
+}
+
+// Enriched transactions are stored as detailed entries
+func isRichTx(tx any) bool {
+	switch tx.(type) {
+	case *RichTx, RichTx:
+		return true
+	}
+	return false
 }
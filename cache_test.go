@@ -0,0 +1,434 @@
+package electrum
+
+import (
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "tx_cache.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	txCache, err := NewTxCache(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caches := map[string]Cache{
+		"TxCache":     txCache,
+		"MemoryCache": NewMemoryCache(3),
+	}
+	for name, cache := range caches {
+		t.Run(name, func(t *testing.T) {
+			defer cache.Close()
+
+			verbose := VerboseTx{TxID: "a", Confirmations: 1}
+			if err := cache.Store("a", verbose); err != nil {
+				t.Fatal(err)
+			}
+			if cache.Load("a", new(RichTx)) {
+				t.Error("verbose entry loaded as detailed")
+			}
+
+			rich := &RichTx{VerboseTx: verbose, FeeInSat: 100}
+			if err := cache.Store("a", rich); err != nil {
+				t.Fatal(err)
+			}
+			if err := cache.Store("a", verbose); err != nil {
+				t.Fatal(err)
+			}
+			loaded := new(RichTx)
+			if !cache.Load("a", loaded) || loaded.FeeInSat != 100 {
+				t.Errorf("detailed entry replaced: %+v", loaded)
+			}
+			tx := new(VerboseTx)
+			if !cache.Load("a", tx) || tx.TxID != "a" {
+				t.Errorf("unexpected verbose entry: %+v", tx)
+			}
+			if cache.Load("missing", tx) {
+				t.Error("unexpected entry")
+			}
+
+			if err := cache.StoreMany(map[string]any{"b": &VerboseTx{TxID: "b"}, "c": &VerboseTx{TxID: "c"}}); err != nil {
+				t.Fatal(err)
+			}
+			txs := cache.LoadMany([]string{"a", "c", "missing"})
+			if len(txs) != 2 || txs["a"].TxID != "a" || txs["c"].TxID != "c" {
+				t.Errorf("unexpected entries: %+v", txs)
+			}
+			if err := cache.Remove("c"); err != nil || cache.Load("c", tx) || !cache.Load("b", tx) {
+				t.Errorf("expected only the removed entry to be dropped: %v", err)
+			}
+
+			if err := cache.StoreItem(itemMerkle, "a:10", 10, &TxMerkle{BlockHeight: 10, Pos: 3}); err != nil {
+				t.Fatal(err)
+			}
+			tm := new(TxMerkle)
+			if !cache.LoadItem(itemMerkle, "a:10", tm) || tm.Pos != 3 {
+				t.Errorf("unexpected item: %+v", tm)
+			}
+			if cache.LoadItem(itemHeader, "a:10", tm) {
+				t.Error("item loaded with a different kind")
+			}
+			if err := cache.PurgeAbove(9); err != nil {
+				t.Fatal(err)
+			}
+			if cache.LoadItem(itemMerkle, "a:10", tm) {
+				t.Error("expected item to be purged")
+			}
+		})
+	}
+
+	t.Run("Eviction", func(t *testing.T) {
+		cache := NewMemoryCache(2)
+		for _, id := range []string{"a", "b"} {
+			_ = cache.Store(id, VerboseTx{TxID: id})
+		}
+		cache.Load("a", new(VerboseTx))
+		_ = cache.Store("c", VerboseTx{TxID: "c"})
+		if cache.Len() != 2 || cache.Load("b", new(VerboseTx)) || !cache.Load("a", new(VerboseTx)) {
+			t.Error("expected the least recently used entry to be evicted")
+		}
+	})
+}
+
+func TestCacheMigrations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tx_cache.db")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Database created by a release without schema versioning
+	if _, err := db.Exec(`
+	CREATE TABLE tx_cache (
+		txid VARCHAR(64) PRIMARY KEY,
+		tx TEXT,
+		is_detailed INTEGER DEFAULT 0
+	)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO tx_cache (txid, tx) VALUES ('a', '{"txid":"a"}')`); err != nil {
+		t.Fatal(err)
+	}
+
+	cache, err := NewTxCache(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Upgrade", func(t *testing.T) {
+		var version int
+		if err := db.QueryRow("SELECT value FROM tx_cache_meta WHERE key = 'schema_version'").Scan(&version); err != nil {
+			t.Fatal(err)
+		}
+		if version != cacheSchemaVersion {
+			t.Errorf("unexpected schema version: %d", version)
+		}
+		if cache.Load("a", new(VerboseTx)) {
+			t.Error("expected legacy entries to be invalidated")
+		}
+	})
+
+	t.Run("ModelVersion", func(t *testing.T) {
+		if err := cache.Store("b", &VerboseTx{TxID: "b", Height: 10}); err != nil {
+			t.Fatal(err)
+		}
+		if !cache.Load("b", new(VerboseTx)) {
+			t.Fatal("expected entry to be loaded")
+		}
+
+		// Simulate entries written by a different data model
+		if _, err := db.Exec("UPDATE tx_cache SET version = version + 1"); err != nil {
+			t.Fatal(err)
+		}
+		if cache.Load("b", new(VerboseTx)) {
+			t.Error("expected stale entry to be ignored")
+		}
+
+		if _, err := db.Exec("UPDATE tx_cache_meta SET value = value + 1 WHERE key = 'model_version'"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewTxCache(db); err != nil {
+			t.Fatal(err)
+		}
+		var count int
+		if err := db.QueryRow("SELECT COUNT(*) FROM tx_cache").Scan(&count); err != nil {
+			t.Fatal(err)
+		}
+		if count != 0 {
+			t.Errorf("expected entries to be dropped, found %d", count)
+		}
+	})
+}
+
+func TestCacheLimits(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "tx_cache.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache, err := NewTxCacheWithOptions(db, &TxCacheOptions{MaxEntries: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+	clock := &testClock{t: time.UnixMilli(1_000_000)}
+	cache.now = clock.now
+
+	for i := 0; i < evictionInterval-1; i++ {
+		id := fmt.Sprintf("%03d", i)
+		if err := cache.Store(id, VerboseTx{TxID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	clock.advance(touchInterval)
+	if !cache.Load("000", new(VerboseTx)) {
+		t.Fatal("expected entry to be loaded")
+	}
+	clock.advance(time.Second)
+	if err := cache.Store("new", VerboseTx{TxID: "new"}); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Eviction", func(t *testing.T) {
+		if !cache.Load("000", new(VerboseTx)) || !cache.Load("new", new(VerboseTx)) {
+			t.Error("expected the most recently used entries to be kept")
+		}
+		if cache.Load("050", new(VerboseTx)) || cache.Load("new", new(RichTx)) {
+			t.Error("unexpected entry")
+		}
+	})
+
+	t.Run("Touch", func(t *testing.T) {
+		lastAccess := func() int64 {
+			var ms int64
+			if err := db.QueryRow("SELECT last_access FROM tx_cache WHERE txid = 'new'").Scan(&ms); err != nil {
+				t.Fatal(err)
+			}
+			return ms
+		}
+
+		// Access times are only updated once they're older than the interval
+		stored := lastAccess()
+		clock.advance(touchInterval - time.Second)
+		if cache.LoadMany([]string{"new"})["new"] == nil || lastAccess() != stored {
+			t.Errorf("unexpected access time update")
+		}
+		clock.advance(time.Second)
+		if cache.LoadMany([]string{"new"})["new"] == nil || lastAccess() != clock.now().UnixMilli() {
+			t.Errorf("expected the access time to be updated")
+		}
+	})
+
+	t.Run("Stats", func(t *testing.T) {
+		stats, err := cache.Stats()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := CacheStats{
+			Verbose:   CacheCounters{Hits: 5, Misses: 1},
+			Detailed:  CacheCounters{Misses: 1},
+			Evictions: evictionInterval - 2,
+			Entries:   2,
+			Bytes:     stats.Bytes,
+		}
+		if stats != expected || stats.Bytes == 0 {
+			t.Errorf("unexpected stats: %+v", stats)
+		}
+	})
+
+	t.Run("Prune", func(t *testing.T) {
+		clock.advance(touchInterval)
+		_ = cache.Load("new", new(VerboseTx))
+		removed, err := cache.Prune(touchInterval)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if removed != 1 || !cache.Load("new", new(VerboseTx)) {
+			t.Errorf("expected only the stale entry to be removed, removed %d", removed)
+		}
+	})
+}
+
+func TestCacheItemLimits(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "tx_cache.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache, err := NewTxCacheWithOptions(db, &TxCacheOptions{MaxEntries: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+	clock := &testClock{t: time.UnixMilli(1_000_000)}
+	cache.now = clock.now
+
+	// Auxiliary items count against the limits shared with the transactions
+	for i := 0; i < evictionInterval-1; i++ {
+		key := fmt.Sprintf("%03d", i)
+		if err := cache.StoreItem(itemHeader, key, int64(i), key); err != nil {
+			t.Fatal(err)
+		}
+		clock.advance(time.Millisecond)
+	}
+	if err := cache.Store("new", VerboseTx{TxID: "new"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var header string
+	if !cache.LoadItem(itemHeader, fmt.Sprintf("%03d", evictionInterval-2), &header) || !cache.Load("new", new(VerboseTx)) {
+		t.Error("expected the most recently used entries to be kept")
+	}
+	if cache.LoadItem(itemHeader, "000", &header) {
+		t.Error("expected the least recently used item to be evicted")
+	}
+
+	stats, err := cache.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Entries != 2 || stats.Evictions != evictionInterval-2 || stats.Bytes == 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestCacheSnapshot(t *testing.T) {
+	open := func(t *testing.T) *TxCache {
+		db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "tx_cache.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cache, err := NewTxCache(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = cache.Close() })
+		return cache
+	}
+
+	source := open(t)
+	_ = source.Store("a", &VerboseTx{TxID: "a", Blockhash: "h", Height: 10})
+	_ = source.Store("b", &RichTx{VerboseTx: VerboseTx{TxID: "b"}, FeeInSat: 100, Height: 11})
+	_ = source.Store("c", &VerboseTx{TxID: "c"})
+
+	var snapshot bytes.Buffer
+	if err := source.Export(&snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Import", func(t *testing.T) {
+		target := open(t)
+		_ = target.Store("a", &RichTx{VerboseTx: VerboseTx{TxID: "a"}, FeeInSat: 50, Height: 10})
+		_ = target.Store("c", &VerboseTx{TxID: "c", Locktime: 1})
+		if err := target.Import(bytes.NewReader(snapshot.Bytes())); err != nil {
+			t.Fatal(err)
+		}
+
+		rich := new(RichTx)
+		if !target.Load("a", rich) || rich.FeeInSat != 50 {
+			t.Errorf("detailed entry replaced by a verbose one: %+v", rich)
+		}
+		if !target.Load("b", rich) || rich.FeeInSat != 100 || rich.Height != 11 {
+			t.Errorf("unexpected imported entry: %+v", rich)
+		}
+		tx := new(VerboseTx)
+		if !target.Load("c", tx) || tx.Locktime != 0 {
+			t.Errorf("verbose entry not replaced: %+v", tx)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		var tampered bytes.Buffer
+		zw := gzip.NewWriter(&tampered)
+		fmt.Fprintf(zw, "{\"format\":%q,\"version\":%d}\n", snapshotFormat, cacheModelVersion)
+		fmt.Fprintln(zw, `{"txid":"a","tx":{"txid":"a"}}`)
+		fmt.Fprintln(zw, `{"txid":"b","tx":{"txid":"a"}}`)
+		_ = zw.Close()
+
+		target := open(t)
+		err := target.Import(&tampered)
+		if err == nil || !strings.Contains(err.Error(), "line 3") {
+			t.Errorf("expected the mismatching entry to be rejected, got %v", err)
+		}
+		if target.Load("a", new(VerboseTx)) {
+			t.Error("expected the snapshot to be rejected as a whole")
+		}
+	})
+}
+
+func TestCacheConcurrency(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "tx_cache.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache, err := NewTxCache(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+
+	var mode string
+	if err := db.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil || mode != "wal" {
+		t.Errorf("unexpected journal mode %q: %v", mode, err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			txs := make(map[string]any)
+			ids := make([]string, 0, 50)
+			for i := 0; i < 50; i++ {
+				id := fmt.Sprintf("%d-%d", w, i)
+				txs[id] = &VerboseTx{TxID: id}
+				ids = append(ids, id)
+				if err := cache.Store(id, &VerboseTx{TxID: id}); err != nil {
+					errs <- err
+					return
+				}
+				cache.Load(id, new(VerboseTx))
+			}
+			if err := cache.StoreMany(txs); err != nil {
+				errs <- err
+				return
+			}
+			if n := len(cache.LoadMany(ids)); n != len(ids) {
+				errs <- fmt.Errorf("loaded %d of %d entries", n, len(ids))
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+// Clock advanced manually, for tests depending on access times
+type testClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *testClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *testClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
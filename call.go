@@ -0,0 +1,45 @@
+package electrum
+
+import (
+	"context"
+	"fmt"
+)
+
+// CallResult holds the outcome of a single call in a batch
+type CallResult[T any] struct {
+	Result T
+	Err    error
+}
+
+// Call runs an arbitrary method, decoding its result into T; useful for methods not
+// wrapped by the client, e.g. server specific extensions like Fulcrum's
+// 'blockchain.transaction.get_height'. Server errors are reported as *RPCError
+func Call[T any](ctx context.Context, c *Client, method string, params ...any) (T, error) {
+	var result T
+	res, err := c.syncRequestContext(ctx, c.req(method, params...))
+	if err != nil {
+		return result, fmt.Errorf("error calling %s: %w", method, err)
+	}
+	if err := decodeResult(res, &result); err != nil {
+		return result, fmt.Errorf("error calling %s: %w", method, err)
+	}
+	return result, nil
+}
+
+// BatchCall runs a method once per set of parameters, using as few batches as
+// 'MaxBatchSize' allows. Results are returned in the same order as the parameters, a
+// failed call doesn't affect the rest; the error is only set when dispatching fails
+func BatchCall[T any](ctx context.Context, c *Client, method string, params [][]any) ([]CallResult[T], error) {
+	res, err := c.syncBatches(ctx, c.batchReq(method, params))
+	if err != nil {
+		return nil, fmt.Errorf("error calling %s: %w", method, err)
+	}
+
+	results := make([]CallResult[T], len(res))
+	for i, r := range res {
+		if err := decodeResult(r, &results[i].Result); err != nil {
+			results[i].Err = fmt.Errorf("error calling %s: %w", method, err)
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,53 @@
+package electrum
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCall(t *testing.T) {
+	client := newMockClient(t, &Options{MaxBatchSize: 2}, func(method string, params []json.RawMessage) (any, *RPCError) {
+		switch method {
+		case "blockchain.transaction.get_height":
+			var hash string
+			_ = json.Unmarshal(params[0], &hash)
+			if hash == "unknown" {
+				return nil, &RPCError{Code: 2, Message: "daemon error"}
+			}
+			return len(hash), nil
+		case "slow":
+			return mockSkip, nil
+		}
+		return nil, &RPCError{Code: -32601, Message: "unknown method"}
+	})
+	ctx := context.Background()
+
+	height, err := Call[int64](ctx, client, "blockchain.transaction.get_height", "abc")
+	if err != nil || height != 3 {
+		t.Errorf("unexpected result %d: %v", height, err)
+	}
+
+	if _, err := Call[int64](ctx, client, "missing"); !errors.Is(err, ErrUnavailableMethod) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	timeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := Call[string](timeout, client, "slow"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	results, err := BatchCall[int64](ctx, client, "blockchain.transaction.get_height", [][]any{{"a"}, {"unknown"}, {"abcd"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 || results[0].Result != 1 || results[2].Result != 4 {
+		t.Errorf("unexpected results: %+v", results)
+	}
+	if !errors.Is(results[1].Err, ErrDaemonError) {
+		t.Errorf("unexpected error: %v", results[1].Err)
+	}
+}
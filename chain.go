@@ -0,0 +1,510 @@
+package electrum
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// How long the chain tip is considered current before querying the server again
+	tipRefreshInterval = 15 * time.Second
+
+	// Number of blocks below the tip within which cached entries are verified against the
+	// active chain; deeper entries are considered final
+	reorgWindow = 100
+)
+
+// Last known state of the active chain; requests are never made while holding the lock
+type chainTip struct {
+	mu      sync.Mutex
+	height  int64
+	hash    string
+	updated time.Time
+
+	// Closed once the refresh in progress completes, nil while idle; 'err' holds the
+	// outcome of the latest refresh
+	refresh chan struct{}
+	err     error
+
+	// Block hashes verified within the reorg window, by height
+	known map[int64]string
+}
+
+// Current height of the active chain. Every time the tip changes the previously observed
+// blocks are verified, purging cached entries belonging to blocks no longer on the active chain
+func (c *Client) tipHeight() (int64, error) {
+	return c.tipHeightContext(context.Background())
+}
+
+// Current height of the active chain, refreshed within the context and the client timeout.
+// Only one refresh runs at a time, other callers get the previous tip rather than waiting,
+// unless none is known yet
+func (c *Client) tipHeightContext(ctx context.Context) (int64, error) {
+	c.tip.mu.Lock()
+	if time.Since(c.tip.updated) < tipRefreshInterval {
+		height := c.tip.height
+		c.tip.mu.Unlock()
+		return height, nil
+	}
+	if done := c.tip.refresh; done != nil {
+		height := c.tip.height
+		c.tip.mu.Unlock()
+		if height > 0 {
+			return height, nil
+		}
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+		c.tip.mu.Lock()
+		defer c.tip.mu.Unlock()
+		if c.tip.err != nil {
+			return 0, c.tip.err
+		}
+		return c.tip.height, nil
+	}
+
+	done := make(chan struct{})
+	c.tip.refresh = done
+	previous := c.tip.hash
+	known := make(map[int64]string, len(c.tip.known))
+	for h, hash := range c.tip.known {
+		known[h] = hash
+	}
+	c.tip.mu.Unlock()
+
+	height, err := c.refreshTip(ctx, previous, known)
+
+	c.tip.mu.Lock()
+	c.tip.refresh = nil
+	c.tip.err = err
+	c.tip.mu.Unlock()
+	close(done)
+	return height, err
+}
+
+// Retrieve the chain tip from the server, checking for reorganizations when it changed since
+// the previous one, then record it along with the verified blocks
+func (c *Client) refreshTip(ctx context.Context, previous string, known map[int64]string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	res, err := c.syncRequestContext(ctx, c.req("blockchain.headers.subscribe"))
+	if err != nil {
+		return 0, err
+	}
+
+	header := new(BlockHeader)
+	if err := decodeObject(res, header); err != nil {
+		return 0, err
+	}
+
+	hash, err := headerHash(header.Hex)
+	if err != nil {
+		return 0, err
+	}
+
+	var orphaned []int64
+	if hash != previous && previous != "" {
+		if orphaned, err = c.checkReorg(ctx, header.Height, known); err != nil {
+			return 0, err
+		}
+	}
+
+	c.tip.mu.Lock()
+	defer c.tip.mu.Unlock()
+	if c.tip.known == nil {
+		c.tip.known = make(map[int64]string)
+	}
+	for _, h := range orphaned {
+		delete(c.tip.known, h)
+	}
+	c.tip.known[header.Height] = hash
+	for h := range c.tip.known {
+		if h <= header.Height-reorgWindow {
+			delete(c.tip.known, h)
+		}
+	}
+
+	c.tip.height = header.Height
+	c.tip.hash = hash
+	c.tip.updated = time.Now()
+	c.health.observeTip(header.Height)
+	return header.Height, nil
+}
+
+// Walk back the previously verified blocks until finding one still on the active chain,
+// cached entries above it are purged; returns the heights of the blocks no longer valid
+func (c *Client) checkReorg(ctx context.Context, height int64, known map[int64]string) ([]int64, error) {
+	heights := make([]int64, 0, len(known))
+	for h := range known {
+		heights = append(heights, h)
+	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] > heights[j] })
+
+	fork := int64(-1)
+	var orphaned []int64
+	for _, h := range heights {
+		if h <= height {
+			hash, err := c.blockHash(ctx, h)
+			if err != nil {
+				return nil, err
+			}
+			if hash == known[h] {
+				fork = h
+				break
+			}
+		}
+		orphaned = append(orphaned, h)
+	}
+
+	// The chain was extended, nothing to purge
+	if len(heights) > 0 && fork == heights[0] {
+		return nil, nil
+	}
+
+	// Fork point not found within the verified blocks, purge above the oldest one
+	if fork < 0 && len(heights) > 0 {
+		fork = heights[len(heights)-1] - 1
+	}
+
+	c.error("chain reorganization detected, purging cache above height %d", fork)
+	return orphaned, c.txCache.PurgeAbove(fork)
+}
+
+// Hash of the block at the given height of the active chain
+func (c *Client) blockHash(ctx context.Context, height int64) (string, error) {
+	res, err := c.syncRequestContext(ctx, c.req("blockchain.block.header", height))
+	if err != nil {
+		return "", err
+	}
+
+	var header string
+	if err := decodeResult(res, &header); err != nil {
+		return "", err
+	}
+	return headerHash(header)
+}
+
+// Calculate the block hash of a serialized header, i.e. the byte-reversed double SHA256
+func headerHash(header string) (string, error) {
+	b, err := hex.DecodeString(header)
+	if err != nil {
+		return "", err
+	}
+	if len(b) != 80 {
+		return "", errors.New("invalid block header")
+	}
+
+	return doubleHash(b), nil
+}
+
+// Byte-reversed double SHA256 of the data, as used by block hashes and transaction IDs
+func doubleHash(b []byte) string {
+	first := sha256.Sum256(b)
+	hash := sha256.Sum256(first[:])
+	for i, j := 0, len(hash)-1; i < j; i, j = i+1, j-1 {
+		hash[i], hash[j] = hash[j], hash[i]
+	}
+	return hex.EncodeToString(hash[:])
+}
+
+// Calculate the ID of a serialized transaction; witness data, if any, is excluded
+func transactionID(tx string) (string, error) {
+	b, err := hex.DecodeString(tx)
+	if err != nil {
+		return "", err
+	}
+
+	// Version, followed by the segwit marker and flag when witness data is present
+	if len(b) < 10 {
+		return "", errors.New("invalid transaction")
+	}
+	if b[4] != 0 || b[5] != 1 {
+		return doubleHash(b), nil
+	}
+
+	r := &txReader{b: b, pos: 6}
+	inputs := r.varInt()
+	for i := uint64(0); i < inputs && r.err == nil; i++ {
+		r.skip(36) // outpoint
+		r.skip(r.varInt())
+		r.skip(4) // sequence
+	}
+	outputs := r.varInt()
+	for i := uint64(0); i < outputs && r.err == nil; i++ {
+		r.skip(8) // value
+		r.skip(r.varInt())
+	}
+	end := r.pos
+	for i := uint64(0); i < inputs && r.err == nil; i++ {
+		items := r.varInt()
+		for j := uint64(0); j < items && r.err == nil; j++ {
+			r.skip(r.varInt())
+		}
+	}
+	r.skip(4) // locktime
+	if r.err != nil || r.pos != len(b) {
+		return "", errors.New("invalid transaction")
+	}
+
+	stripped := make([]byte, 0, len(b))
+	stripped = append(stripped, b[:4]...)
+	stripped = append(stripped, b[6:end]...)
+	stripped = append(stripped, b[len(b)-4:]...)
+	return doubleHash(stripped), nil
+}
+
+// Sequential reader of serialized data, failing once reading past the end
+type txReader struct {
+	b   []byte
+	pos int
+	err error
+}
+
+func (r *txReader) skip(n uint64) {
+	if r.err != nil || n > uint64(len(r.b)-r.pos) {
+		r.err = errors.New("unexpected end of data")
+		return
+	}
+	r.pos += int(n)
+}
+
+func (r *txReader) varInt() uint64 {
+	if r.skip(1); r.err != nil {
+		return 0
+	}
+	var size int
+	switch prefix := r.b[r.pos-1]; prefix {
+	case 0xfd:
+		size = 2
+	case 0xfe:
+		size = 4
+	case 0xff:
+		size = 8
+	default:
+		return uint64(prefix)
+	}
+	if r.skip(uint64(size)); r.err != nil {
+		return 0
+	}
+	var n uint64
+	for i := size - 1; i >= 0; i-- {
+		n = n<<8 | uint64(r.b[r.pos-size+i])
+	}
+	return n
+}
+
+// Load a transaction from the cache, refreshing its confirmations from the current tip.
+// Entries stored without a block reference are ignored, and entries within the reorg window
+// are verified to belong to the active chain
+func (c *Client) loadTx(txID string, tx any) bool {
+	if ok := c.txCache.Load(txID, tx); !ok {
+		return false
+	}
+	return c.validCached(tx)
+}
+
+// Load many verbose transactions from the cache at once, with the same checks as 'loadTx'
+func (c *Client) loadTxs(txIDs []string) map[string]*VerboseTx {
+	if c.txCache == NoCache || len(txIDs) == 0 {
+		return nil
+	}
+
+	txs := c.txCache.LoadMany(txIDs)
+	for txID, tx := range txs {
+		if !c.validCached(tx) {
+			delete(txs, txID)
+		}
+	}
+	return txs
+}
+
+// Verify a cached transaction still belongs to the active chain, refreshing its confirmations
+func (c *Client) validCached(tx any) bool {
+	blockHash, height := txBlock(tx)
+	if height <= 0 {
+		return false
+	}
+
+	tip, err := c.tipHeight()
+	if err != nil {
+		c.error("refreshing chain tip failed: %v", err)
+		return false
+	}
+
+	if height > tip-reorgWindow {
+		active, err := c.activeBlockHash(height)
+		if err != nil {
+			c.error("verifying block %d failed: %v", height, err)
+			return false
+		}
+		if active != blockHash {
+			c.dropOrphaned(tx, height)
+			return false
+		}
+	}
+
+	verboseTx(tx).Confirmations = int32(tip - height + 1)
+	return true
+}
+
+// Drop a cached transaction whose block is no longer at its height on the active chain.
+// When the height comes from the server the block was reorganized and every entry above it
+// is purged; a height provided by the caller may just be wrong, only the entry is dropped
+func (c *Client) dropOrphaned(tx any, height int64) {
+	if !serverHeight(tx) {
+		txID := verboseTx(tx).TxID
+		if err := c.txCache.Remove(txID); err != nil {
+			c.error("removing tx %s from cache failed: %v", txID, err)
+		}
+		return
+	}
+	if err := c.txCache.PurgeAbove(height - 1); err != nil {
+		c.error("purging cache above height %d failed: %v", height-1, err)
+	}
+}
+
+// Reports whether the block height of a cached transaction was derived from the server
+// tip, or confirmed by its merkle proof, rather than provided by the caller
+func serverHeight(tx any) bool {
+	if r, ok := tx.(*RichTx); ok {
+		return int64(r.Merkle.BlockHeight) == r.Height
+	}
+	return true
+}
+
+// Hash of the block at the given height of the active chain, remembered while within the
+// reorg window
+func (c *Client) activeBlockHash(height int64) (string, error) {
+	c.tip.mu.Lock()
+	hash, ok := c.tip.known[height]
+	c.tip.mu.Unlock()
+	if ok {
+		return hash, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	hash, err := c.blockHash(ctx, height)
+	if err != nil {
+		return "", err
+	}
+
+	c.tip.mu.Lock()
+	if c.tip.known == nil {
+		c.tip.known = make(map[int64]string)
+	}
+	c.tip.known[height] = hash
+	c.tip.mu.Unlock()
+	return hash, nil
+}
+
+// Store a transaction in the cache once it's buried deep enough in the chain
+func (c *Client) storeTx(txID string, tx any) {
+	if !c.cacheable(txID, tx) {
+		return
+	}
+	if err := c.txCache.Store(txID, tx); err != nil {
+		c.error("Store tx %s in cache failed: %v", txID, err)
+	}
+}
+
+// Store many verbose transactions at once, with the same checks as 'storeTx'
+func (c *Client) storeTxs(txs []*VerboseTx) {
+	entries := make(map[string]any, len(txs))
+	for _, tx := range txs {
+		if tx != nil && c.cacheable(tx.TxID, tx) {
+			entries[tx.TxID] = tx
+		}
+	}
+	if err := c.txCache.StoreMany(entries); err != nil {
+		c.error("Store %d txs in cache failed: %v", len(entries), err)
+	}
+}
+
+// Reports whether a transaction is buried deep enough to be cached, resolving the height
+// of the block including it
+func (c *Client) cacheable(txID string, tx any) bool {
+	v := verboseTx(tx)
+	if c.txCache == NoCache || v == nil || v.Confirmations < c.cacheDepth {
+		return false
+	}
+
+	r, rich := tx.(*RichTx)
+	if rich && r.Height <= 0 || !rich && v.Height <= 0 {
+		height, err := c.deriveHeight(v)
+		if err != nil {
+			c.error("resolving height of tx %s failed: %v", txID, err)
+			return false
+		}
+		v.Height = height
+		if rich {
+			r.Height = height
+		}
+	}
+	return true
+}
+
+// Block height of a verbose transaction, derived from its confirmations. The tip known by the
+// client may lag behind the one used by the server, so heights within the reorg window are
+// verified against the block hash
+func (c *Client) deriveHeight(tx *VerboseTx) (int64, error) {
+	tip, err := c.tipHeight()
+	if err != nil {
+		return 0, err
+	}
+
+	height := tip - int64(tx.Confirmations) + 1
+	if height <= tip-reorgWindow {
+		return height, nil
+	}
+
+	for _, h := range []int64{height, height + 1} {
+		if h > tip {
+			break
+		}
+		hash, err := c.activeBlockHash(h)
+		if err != nil {
+			return 0, err
+		}
+		if hash == tx.Blockhash {
+			return h, nil
+		}
+	}
+	return 0, fmt.Errorf("block %s not found on the active chain", tx.Blockhash)
+}
+
+// Access the verbose details of a cached transaction value
+func verboseTx(tx any) *VerboseTx {
+	switch t := tx.(type) {
+	case *VerboseTx:
+		return t
+	case *RichTx:
+		return &t.VerboseTx
+	}
+	return nil
+}
+
+// Block reference of a cached transaction value
+func txBlock(tx any) (string, int64) {
+	switch t := tx.(type) {
+	case *VerboseTx:
+		return t.Blockhash, t.Height
+	case VerboseTx:
+		return t.Blockhash, t.Height
+	case *RichTx:
+		return t.Blockhash, t.Height
+	case RichTx:
+		return t.Blockhash, t.Height
+	}
+	return "", 0
+}
@@ -0,0 +1,212 @@
+package electrum
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHeaderHash(t *testing.T) {
+	genesis := "0100000000000000000000000000000000000000000000000000000000000000000000003ba3edfd7a7b12b27ac72c3e67768f617fc81bc3888a51323a9fb8aa4b1e5e4a29ab5f49ffff001d1dac2b7c"
+	hash, err := headerHash(genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != "000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f" {
+		t.Errorf("unexpected hash: %s", hash)
+	}
+	if _, err := headerHash("00"); err == nil {
+		t.Error("expected an error for a truncated header")
+	}
+}
+
+// Chain served by the mock server, blocks at or above the fork height change
+// once a reorganization is triggered
+type mockChain struct {
+	sync.Mutex
+	tip  int64
+	fork int64
+	gets int
+}
+
+func (m *mockChain) header(height int64) string {
+	b := make([]byte, 80)
+	binary.LittleEndian.PutUint64(b, uint64(height))
+	if m.fork > 0 && height >= m.fork {
+		b[8] = 1
+	}
+	return hex.EncodeToString(b)
+}
+
+func (m *mockChain) hash(height int64) string {
+	hash, _ := headerHash(m.header(height))
+	return hash
+}
+
+func TestReorgSafeCache(t *testing.T) {
+	chain := &mockChain{tip: 100}
+	txID := strings.Repeat("a", 64)
+	client := newMockClient(t, nil, func(method string, params []json.RawMessage) (any, *RPCError) {
+		chain.Lock()
+		defer chain.Unlock()
+		switch method {
+		case "blockchain.headers.subscribe":
+			return &BlockHeader{Height: chain.tip, Hex: chain.header(chain.tip)}, nil
+		case "blockchain.block.header":
+			var height int64
+			_ = json.Unmarshal(params[0], &height)
+			return chain.header(height), nil
+		case "blockchain.transaction.get":
+			chain.gets++
+			return &VerboseTx{TxID: txID, Blockhash: chain.hash(91), Confirmations: int32(chain.tip - 90)}, nil
+		}
+		return nil, &RPCError{Message: "unknown method"}
+	})
+
+	advance := func(tip, fork int64) {
+		chain.Lock()
+		chain.tip, chain.fork = tip, fork
+		chain.Unlock()
+		client.tip.mu.Lock()
+		client.tip.updated = time.Time{}
+		client.tip.mu.Unlock()
+	}
+
+	get := func(t *testing.T, confirmations int32, height int64, gets int) {
+		t.Helper()
+		tx, err := client.GetVerboseTransaction(txID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tx.Confirmations != confirmations || tx.Height != height {
+			t.Errorf("expected %d confirmations at height %d, got %d at %d", confirmations, height, tx.Confirmations, tx.Height)
+		}
+		chain.Lock()
+		defer chain.Unlock()
+		if chain.gets != gets {
+			t.Errorf("expected %d requests, got %d", gets, chain.gets)
+		}
+	}
+
+	t.Run("Store", func(t *testing.T) {
+		get(t, 10, 91, 1)
+		get(t, 10, 91, 1)
+	})
+
+	t.Run("Confirmations", func(t *testing.T) {
+		advance(150, 0)
+		get(t, 60, 91, 1)
+	})
+
+	t.Run("Reorg", func(t *testing.T) {
+		advance(151, 80)
+		get(t, 61, 91, 2)
+	})
+
+	t.Run("CallerHeight", func(t *testing.T) {
+		chain.Lock()
+		kept := &VerboseTx{TxID: strings.Repeat("b", 64), Blockhash: chain.hash(140), Confirmations: 12, Height: 140}
+		rich := &RichTx{VerboseTx: VerboseTx{TxID: strings.Repeat("c", 64), Blockhash: chain.hash(91), Confirmations: 61}, Height: 145}
+		rich.Merkle.BlockHeight = 91
+		chain.Unlock()
+		if err := client.txCache.StoreMany(map[string]any{kept.TxID: kept, rich.TxID: rich}); err != nil {
+			t.Fatal(err)
+		}
+
+		// A wrong height provided when enriching only drops the entry itself
+		if client.loadTx(rich.TxID, new(RichTx)) {
+			t.Error("expected the entry at the wrong height to be rejected")
+		}
+		if client.txCache.Load(rich.TxID, new(RichTx)) {
+			t.Error("expected the entry to be removed")
+		}
+		if !client.loadTx(kept.TxID, new(VerboseTx)) {
+			t.Error("expected other entries to be kept")
+		}
+	})
+
+	t.Run("Depth", func(t *testing.T) {
+		client.cacheDepth = 100
+		_ = client.txCache.PurgeAbove(0)
+		get(t, 61, 0, 3)
+		get(t, 61, 0, 4)
+	})
+}
+
+func TestTransactionID(t *testing.T) {
+	genesis := "01000000010000000000000000000000000000000000000000000000000000000000000000ffffffff4d04ffff001d0104455468652054696d65732030332f4a616e2f32303039204368616e63656c6c6f72206f6e206272696e6b206f66207365636f6e64206261696c6f757420666f722062616e6b73ffffffff0100f2052a01000000434104678afdb0fe5548271967f1a67130b7105cd6a828e03909a67962e0ea1f61deb649f6bc3f4cef38c4f35504e51ec112de5c384df7ba0b8d578a4c702b6bf11d5fac00000000"
+	txID := "4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b"
+
+	// Same transaction including the segwit marker and a witness for its input
+	body := genesis[8 : len(genesis)-8]
+	witness := genesis[:8] + "0001" + body + "0102abcd" + genesis[len(genesis)-8:]
+
+	for name, tx := range map[string]string{"Legacy": genesis, "Witness": witness} {
+		id, err := transactionID(tx)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if id != txID {
+			t.Errorf("%s: unexpected txid %s", name, id)
+		}
+	}
+
+	if _, err := transactionID(witness[:len(witness)-10]); err == nil {
+		t.Error("expected an error for a truncated transaction")
+	}
+}
+
+func TestTipRefresh(t *testing.T) {
+	var mu sync.Mutex
+	var requests int
+	release := make(chan struct{})
+	client := newMockClient(t, nil, func(method string, params []json.RawMessage) (any, *RPCError) {
+		if method != "blockchain.headers.subscribe" {
+			return nil, &RPCError{Message: "unknown method"}
+		}
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		<-release
+		return &BlockHeader{Height: 100, Hex: hex.EncodeToString(make([]byte, 80))}, nil
+	})
+
+	// Callers arriving while the first tip is retrieved wait for it instead of sending
+	// their own request
+	heights := make(chan int64, 5)
+	for i := 0; i < cap(heights); i++ {
+		go func() {
+			height, err := client.tipHeight()
+			if err != nil {
+				t.Error(err)
+			}
+			heights <- height
+		}()
+	}
+	for {
+		client.tip.mu.Lock()
+		refreshing := client.tip.refresh != nil
+		client.tip.mu.Unlock()
+		if refreshing {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+
+	for i := 0; i < cap(heights); i++ {
+		if height := <-heights; height != 100 {
+			t.Errorf("unexpected height: %d", height)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if requests != 1 {
+		t.Errorf("expected a single request, got %d", requests)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"reflect"
 	"strconv"
 	"strings"
 	"sync"
@@ -40,6 +41,66 @@ var (
 	ErrUnavailableMethod = errors.New("UNAVAILABLE_METHOD")
 	ErrRejectedTx        = errors.New("REJECTED_TRANSACTION")
 	ErrUnreachableHost   = errors.New("UNREACHABLE_HOST")
+	ErrTxNotFound        = errors.New("TX_NOT_FOUND")
+	ErrServerFailure     = errors.New("SERVER_FAILURE")
+	ErrMissingResponse   = errors.New("MISSING_RESPONSE")
+	ErrNoFeeEstimate     = errors.New("NO_FEE_ESTIMATE")
+	ErrInvalidProof      = errors.New("INVALID_PROOF")
+
+	// Server errors, matched by the code of an RPCError
+	ErrBadRequest             = errors.New("BAD_REQUEST")
+	ErrDaemonError            = errors.New("DAEMON_ERROR")
+	ErrExcessiveResourceUsage = errors.New("EXCESSIVE_RESOURCE_USAGE")
+	ErrServerBusy             = errors.New("SERVER_BUSY")
+)
+
+// TxError describes why a single transaction in a batch couldn't be retrieved; use
+// 'errors.Is' with ErrTxNotFound, ErrServerFailure or ErrMissingResponse to classify it
+type TxError struct {
+	TxID string
+	Kind error
+	Err  error
+}
+
+func (e *TxError) Error() string {
+	return fmt.Sprintf("error getting verbose transaction %s: %v", e.TxID, e.Err)
+}
+
+// Unwrap allows matching both the error kind and the underlying error
+func (e *TxError) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// Classify the failure to retrieve a transaction
+func newTxError(txID string, res *response, err error) *TxError {
+	kind := ErrServerFailure
+	switch {
+	case res == nil:
+		kind = ErrMissingResponse
+	case res.Error != nil && isNotFound(res.Error.Message):
+		kind = ErrTxNotFound
+	}
+	return &TxError{TxID: txID, Kind: kind, Err: err}
+}
+
+// Servers relay the daemon message when a transaction is unknown, e.g.
+// "No such mempool or blockchain transaction"
+func isNotFound(msg string) bool {
+	msg = strings.ToLower(msg)
+	return strings.Contains(msg, "no such mempool") ||
+		strings.Contains(msg, "transaction not found")
+}
+
+// CoinbaseFeeMode determines how the fee of a coinbase transaction is reported
+type CoinbaseFeeMode int
+
+// Coinbase fee modes
+const (
+	// Report a zero fee, coinbase transactions don't pay any fee
+	CoinbaseFeeZero CoinbaseFeeMode = iota
+
+	// Report the block subsidy claimed by the transaction as its fee
+	CoinbaseFeeSubsidy
 )
 
 // Options define the available configuration options
@@ -72,6 +133,46 @@ type Options struct {
 
 	// The maximum number of transactions to fetch in a single batch
 	MaxBatchSize uint32
+
+	// The maximum number of batches dispatched concurrently when fetching
+	// many transactions, defaults to 4
+	MaxConcurrentBatches uint32
+
+	// Determines the fee reported when enriching coinbase transactions,
+	// zero by default
+	CoinbaseFee CoinbaseFeeMode
+
+	// If provided, will be used to store retrieved transactions; defaults to a sqlite
+	// cache on the 'tx_cache.db' file of the working directory. Use 'NoCache' to
+	// disable caching
+	Cache Cache
+
+	// Minimum number of confirmations required before a transaction, merkle proof or
+	// block header is cached, defaults to 6
+	CacheDepth uint32
+
+	// Cache scripthash histories, validated against the status reported by the server
+	// before being reused. Retrieving the status subscribes the connection to changes
+	// of the scripthash
+	CacheHistories bool
+
+	// The maximum number of requests awaiting a response, unlimited by default; every
+	// call of a batch counts as a request
+	MaxInFlight uint32
+
+	// The maximum number of requests awaiting a response per priority lane, unlimited
+	// by default. Requests are dispatched by priority, set with 'WithPriority'; single
+	// requests default to PriorityNormal and batches to PriorityBulk
+	LaneLimits map[Priority]uint32
+
+	// The maximum number of requests sent per second, unlimited by default; every call of
+	// a batch counts as a request. Messages are spaced further apart while the server
+	// reports excessive resource usage regardless
+	RateLimit float64
+
+	// The number of requests that can be sent at once while under the rate limit,
+	// defaults to the rate limit
+	RateBurst uint32
 }
 
 // Client defines the protocol client instance structure and interface
@@ -98,9 +199,28 @@ type Client struct {
 	stopResuming context.CancelFunc
 	sync.Mutex
 
-	txCache *TxCache
+	txCache        Cache
+	ownsCache      bool
+	cacheDepth     int32
+	cacheHistories bool
+	tip            chainTip
+
+	timeout          time.Duration
+	maxBatchSize     uint32
+	batchConcurrency uint32
+	coinbaseFee      CoinbaseFeeMode
+	sched            *scheduler
+	health           healthStats
+
+	// Verbose transaction requests in progress, shared by concurrent callers
+	inflight   map[string]*txCall
+	inflightMu sync.Mutex
+}
 
-	maxBatchSize uint32
+// Pending verbose transaction request
+type txCall struct {
+	TxResult
+	done chan struct{}
 }
 
 type subscription struct {
@@ -109,6 +229,9 @@ type subscription struct {
 	messages chan *response
 	handler  func(*response)
 	ctx      context.Context
+
+	// Used by batch requests, signaled once a batch reply has been completely routed
+	batchEnd chan struct{}
 }
 
 // New will create and start processing on a new client instance
@@ -138,30 +261,54 @@ func New(options *Options) (*Client, error) {
 		options.Agent = "fairbank-electrum"
 	}
 
-	txCache, err := NewTxCache(nil)
-	if err != nil {
-		return nil, err
+	// Use a sqlite cache on the working directory unless provided
+	txCache, ownsCache := options.Cache, false
+	if txCache == nil {
+		if txCache, err = NewTxCache(nil); err != nil {
+			return nil, err
+		}
+		ownsCache = true
 	}
 
 	if options.MaxBatchSize == 0 {
 		options.MaxBatchSize = 80
 	}
 
+	if options.CacheDepth == 0 {
+		options.CacheDepth = 6
+	}
+
+	if options.Timeout == 0 {
+		options.Timeout = defultTimeout
+	}
+
+	if options.MaxConcurrentBatches == 0 {
+		options.MaxConcurrentBatches = 4
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	client := &Client{
-		transport:    t,
-		counter:      0,
-		bgProcessing: ctx,
-		cleanUp:      cancel,
-		done:         make(chan bool),
-		subs:         make(map[int]*subscription),
-		log:          options.Log,
-		agent:        fmt.Sprintf("%s-%s", options.Agent, options.Version),
-		Address:      options.Address,
-		Version:      options.Version,
-		Protocol:     options.Protocol,
-		txCache:      txCache,
-		maxBatchSize: options.MaxBatchSize,
+		transport:        t,
+		counter:          0,
+		bgProcessing:     ctx,
+		cleanUp:          cancel,
+		done:             make(chan bool),
+		subs:             make(map[int]*subscription),
+		log:              options.Log,
+		agent:            fmt.Sprintf("%s-%s", options.Agent, options.Version),
+		Address:          options.Address,
+		Version:          options.Version,
+		Protocol:         options.Protocol,
+		txCache:          txCache,
+		ownsCache:        ownsCache,
+		cacheDepth:       int32(options.CacheDepth),
+		cacheHistories:   options.CacheHistories,
+		sched:            newScheduler(options.MaxInFlight, options.LaneLimits, options.RateLimit, options.RateBurst),
+		timeout:          options.Timeout,
+		maxBatchSize:     options.MaxBatchSize,
+		batchConcurrency: options.MaxConcurrentBatches,
+		coinbaseFee:      options.CoinbaseFee,
+		inflight:         make(map[string]*txCall),
 	}
 
 	// Automatically send a 'server.version' or 'server.ping' request every 60 seconds as a keep-alive
@@ -204,8 +351,8 @@ func (c *Client) keepAlive() {
 				if b, err := c.req("server.version", c.Version, c.Protocol).encode(); err == nil {
 					/* #nosec */
 					err = c.transport.sendMessage(b)
-					if err != nil && c.log != nil {
-						c.log.Error("%v", err)
+					if err != nil {
+						c.error("keep-alive failed: %v", err)
 					}
 				}
 			case <-c.bgProcessing.Done():
@@ -215,8 +362,10 @@ func (c *Client) keepAlive() {
 	}()
 }
 
+// Log a debug message; formatting is skipped unless enabled, as messages may include
+// complete server responses
 func (c *Client) debug(msg string, args ...any) {
-	if c.log != nil {
+	if c.log != nil && c.log.Enabled(context.Background(), slog.LevelDebug) {
 		c.log.Debug(fmt.Sprintf(msg, args...))
 	}
 }
@@ -262,7 +411,13 @@ func (c *Client) handleMessages() {
 	for {
 		select {
 		case <-c.done:
+			c.Lock()
+			ids := make([]int, 0, len(c.subs))
 			for id := range c.subs {
+				ids = append(ids, id)
+			}
+			c.Unlock()
+			for _, id := range ids {
 				c.removeSubscription(id)
 			}
 			c.cleanUp()
@@ -272,58 +427,110 @@ func (c *Client) handleMessages() {
 		case m := <-c.transport.messages:
 			c.debug("received msg: %s", m)
 
-			var result interface{}
-			if err := json.Unmarshal(m, &result); err != nil {
-				c.error("error unmarshalling any: %v\n", err)
+			responses, batch, err := decodeMessage(m)
+			if err != nil {
+				c.error("error unmarshalling message: %v", err)
 				break
 			}
 
-			var responses []*response
-			if _, ok := result.([]interface{}); ok {
-				// Batch response
-				if err := json.Unmarshal(m, &responses); err != nil {
-					c.error("error unmarshalling batch responses: %v\n", err)
-					break
-				}
+			if batch {
+				c.handleBatchResponse(responses)
 			} else {
-				// Single response
-
-				resp := &response{}
-				if err := json.Unmarshal(m, resp); err != nil {
-					c.error("error unmarshalling one response: %v\n", err)
-					break
-				}
-
-				responses = append(responses, resp)
+				c.handleResponse(responses[0])
 			}
+		}
+	}
+}
 
-			for _, resp := range responses {
-				c.handleResponse(resp)
+// Decode a message received from the server, either a single response or a batch reply;
+// batch replies are detected by their leading byte so every message is decoded only once,
+// results are kept raw until decoded into their target type
+func decodeMessage(m []byte) ([]*response, bool, error) {
+	if isBatch(m) {
+		var responses []*response
+		if err := json.Unmarshal(m, &responses); err != nil {
+			return nil, true, fmt.Errorf("error unmarshalling batch responses: %w", err)
+		}
+		for _, resp := range responses {
+			if resp == nil {
+				return nil, true, errors.New("error unmarshalling batch responses: null entry")
 			}
 		}
+		return responses, true, nil
+	}
+
+	resp := &response{}
+	if err := json.Unmarshal(m, resp); err != nil {
+		return nil, false, fmt.Errorf("error unmarshalling one response: %w", err)
+	}
+	return []*response{resp}, false, nil
+}
+
+// Reports whether a message is a JSON array, skipping any leading whitespace
+func isBatch(m []byte) bool {
+	for _, b := range m {
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		return b == '['
 	}
+	return false
 }
 
-func (c *Client) handleResponse(resp *response) {
+// Route all the responses of a batch reply, the batches involved are notified once done
+// allowing them to detect missing responses
+func (c *Client) handleBatchResponse(responses []*response) {
+	batches := make(map[*subscription]bool)
+	for _, resp := range responses {
+		if sub := c.handleResponse(resp); sub != nil && sub.batchEnd != nil {
+			batches[sub] = true
+		}
+	}
+	for sub := range batches {
+		select {
+		case sub.batchEnd <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (c *Client) handleResponse(resp *response) *subscription {
 	// Message routed by method name
 	if resp.Method != "" {
 		c.Lock()
 		for _, sub := range c.subs {
 			if sub.method == resp.Method {
-				sub.messages <- resp
+				sub.deliver(resp)
 			}
 		}
 		c.Unlock()
 
-		return
+		return nil
 	}
 
 	// Message routed by ID
 	c.Lock()
 	sub, ok := c.subs[resp.ID]
 	c.Unlock()
-	if ok {
+	if ok && sub.deliver(resp) {
+		return sub
+	}
+	return nil
+}
+
+// Pass a response to the subscription, giving up if the subscription is terminated
+// before the message is received
+func (sub *subscription) deliver(resp *response) bool {
+	if sub.ctx == nil {
 		sub.messages <- resp
+		return true
+	}
+	select {
+	case sub.messages <- resp:
+		return true
+	case <-sub.ctx.Done():
+		return false
 	}
 }
 
@@ -333,7 +540,10 @@ func (c *Client) removeSubscription(id int) {
 	defer c.Unlock()
 	sub, ok := c.subs[id]
 	if ok {
-		close(sub.messages)
+		// Batch requests share a single subscription and perform their own cleanup
+		if sub.batchEnd == nil {
+			close(sub.messages)
+		}
 		delete(c.subs, id)
 	}
 }
@@ -408,6 +618,11 @@ func (c *Client) startSubscription(sub *subscription) error {
 		c.removeSubscription(req.ID)
 		return err
 	}
+	if err := c.sched.acquire(sub.ctx, PriorityNormal, 1); err != nil {
+		c.removeSubscription(req.ID)
+		return err
+	}
+	c.sched.release(PriorityNormal, 1)
 	if err := c.transport.sendMessage(b); err != nil {
 		c.removeSubscription(req.ID)
 		return err
@@ -417,12 +632,24 @@ func (c *Client) startSubscription(sub *subscription) error {
 
 // Dispatch a synchronous request, i.e. wait for it's result
 func (c *Client) syncRequest(req *request) (*response, error) {
-	// Setup a subscription for the request with proper cleanup
+	return c.syncRequestContext(context.Background(), req)
+}
+
+// Dispatch a synchronous request, waiting for it's result until the context is done
+func (c *Client) syncRequestContext(ctx context.Context, req *request) (*response, error) {
+	// Setup a subscription for the request with proper cleanup; the channel is left open
+	// as a response may still be in delivery, which gives up once the context is canceled
+	ctx, cancel := context.WithCancel(ctx)
 	res := make(chan *response)
 	c.Lock()
-	c.subs[req.ID] = &subscription{messages: res}
+	c.subs[req.ID] = &subscription{ctx: ctx, messages: res}
 	c.Unlock()
-	defer c.removeSubscription(req.ID)
+	defer func() {
+		cancel()
+		c.Lock()
+		delete(c.subs, req.ID)
+		c.Unlock()
+	}()
 
 	// Encode and dispatch the request
 	b, err := req.encode()
@@ -432,15 +659,38 @@ func (c *Client) syncRequest(req *request) (*response, error) {
 
 	b = append(b, delimiter)
 
+	priority := priorityOf(ctx, PriorityNormal)
+	if err := c.sched.acquire(ctx, priority, 1); err != nil {
+		return nil, err
+	}
+	defer c.sched.release(priority, 1)
+
 	// Log request
 	c.debug("sending msg: %s", b)
 
+	sent := time.Now()
 	if err := c.transport.sendMessage(b); err != nil {
+		c.health.request(0, err)
 		return nil, err
 	}
 
 	// Wait for the response
-	return <-res, nil
+	select {
+	case resp, ok := <-res:
+		if !ok {
+			c.health.request(0, ErrUnreachableHost)
+			return nil, ErrUnreachableHost
+		}
+		c.sched.observe(resp)
+		c.health.request(time.Since(sent), responseError(resp))
+		return resp, nil
+	case <-ctx.Done():
+		c.health.request(0, ctx.Err())
+		return nil, ctx.Err()
+	case <-c.bgProcessing.Done():
+		c.health.request(0, ErrUnreachableHost)
+		return nil, ErrUnreachableHost
+	}
 }
 
 func encodeBatch(reqs []*request) ([]byte, error) {
@@ -457,17 +707,32 @@ func encodeBatch(reqs []*request) ([]byte, error) {
 	return []byte(arrayStart + strings.Join(reqsJson, comma) + arrayEnd), nil
 }
 
-// Dispatch a batch of synchronous requests, i.e. wait for it's result
-func (c *Client) syncBatchRequest(reqs []*request) ([]*response, error) {
+// Dispatch a batch of synchronous requests, i.e. wait for it's result. Servers reply to a
+// batch with a single message, any request left without a response once that message is
+// processed, or the operation times out, gets a nil entry in the returned list
+func (c *Client) syncBatchRequest(ctx context.Context, reqs []*request) ([]*response, error) {
 	reqMap := make(map[int]int, len(reqs))
 	// Setup a subscription for the request with proper cleanup
-	res := make(chan *response)
+	ctx, cancel := context.WithCancel(ctx)
+	sub := &subscription{
+		ctx:      ctx,
+		messages: make(chan *response),
+		batchEnd: make(chan struct{}, 1),
+	}
 	c.Lock()
 	for i, req := range reqs {
-		c.subs[req.ID] = &subscription{messages: res}
+		c.subs[req.ID] = sub
 		reqMap[req.ID] = i
 	}
 	c.Unlock()
+	defer func() {
+		cancel()
+		c.Lock()
+		for _, req := range reqs {
+			delete(c.subs, req.ID)
+		}
+		c.Unlock()
+	}()
 
 	// Encode and dispatch the request
 	b, err := encodeBatch(reqs)
@@ -477,38 +742,116 @@ func (c *Client) syncBatchRequest(reqs []*request) ([]*response, error) {
 
 	b = append(b, delimiter)
 
+	priority := priorityOf(ctx, PriorityBulk)
+	if err := c.sched.acquire(ctx, priority, len(reqs)); err != nil {
+		return nil, err
+	}
+	defer c.sched.release(priority, len(reqs))
+
 	// Log request
 	c.debug("sending msg: %s", b)
 
+	sent := time.Now()
 	if err := c.transport.sendMessage(b); err != nil {
+		c.health.request(0, err)
 		return nil, err
 	}
 
 	// Wait for the response
-	respCount := 0
+	timeout := time.NewTimer(c.timeout)
+	defer timeout.Stop()
 
 	responses := make([]*response, len(reqs))
-	for resp := range res {
-		c.Lock()
-		delete(c.subs, resp.ID)
-		c.Unlock()
-
-		responses[reqMap[resp.ID]] = resp
+	for respCount := 0; respCount < len(reqs); {
+		select {
+		case resp := <-sub.messages:
+			i, ok := reqMap[resp.ID]
+			if !ok || responses[i] != nil {
+				continue
+			}
+			responses[i] = resp
+			respCount++
+			c.sched.observe(resp)
+		case <-sub.batchEnd:
+			c.error("batch reply is missing %d responses", len(reqs)-respCount)
+			c.health.request(time.Since(sent), ErrMissingResponse)
+			return responses, nil
+		case <-timeout.C:
+			c.error("batch request timed out waiting for %d responses", len(reqs)-respCount)
+			c.health.request(0, ErrMissingResponse)
+			return responses, nil
+		case <-ctx.Done():
+			c.health.request(0, ctx.Err())
+			return nil, ctx.Err()
+		case <-c.bgProcessing.Done():
+			c.health.request(0, ErrUnreachableHost)
+			return nil, ErrUnreachableHost
+		}
+	}
 
-		respCount++
+	c.health.request(time.Since(sent), batchError(responses))
+	return responses, nil
+}
 
-		if respCount == len(reqs) {
-			close(res)
+// First server side error reported by the responses of a batch, if any
+func batchError(responses []*response) error {
+	for _, resp := range responses {
+		if resp.Error != nil && serverError(resp.Error) {
+			return resp.Error
 		}
 	}
+	return nil
+}
 
-	return responses, nil
+// Decode the result of a response into the provided value; a missing or null result
+// leaves the value untouched
+func decodeResult(res *response, v any) error {
+	if res == nil {
+		return ErrMissingResponse
+	}
+	if res.Error != nil {
+		return res.Error
+	}
+	if len(res.Result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(res.Result, v)
+}
+
+// Decode a result expected to hold an object into the provided value; a missing or null
+// result is reported as ErrMissingResponse
+func decodeObject(res *response, v any) error {
+	if res != nil && res.Error == nil && (len(res.Result) == 0 || string(res.Result) == "null") {
+		return ErrMissingResponse
+	}
+	return decodeResult(res, v)
+}
+
+// Decode a result into a value of any type; structs, and pointers to them, are objects
+// decoded like 'decodeObject' so a null result isn't mistaken for an empty value. Other
+// types, e.g. a *string status, may legitimately be null
+func decodeValue[T any](res *response, v *T) error {
+	t := reflect.TypeOf(v).Elem()
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Struct {
+		return decodeObject(res, v)
+	}
+	return decodeResult(res, v)
 }
 
 // Close will finish execution and properly terminate the underlying network transport
 func (c *Client) Close() {
 	c.transport.close()
 	close(c.done)
+
+	// Caches provided with the options are managed by the caller
+	if c.ownsCache {
+		if err := c.txCache.Close(); err != nil {
+			c.error("closing cache failed: %v", err)
+		}
+	}
 }
 
 // ServerPing will send a ping message to the server to ensure it is responding, and to keep the
@@ -516,19 +859,27 @@ func (c *Client) Close() {
 //
 // https://electrumx.readthedocs.io/en/latest/protocol-methods.html#server-ping
 func (c *Client) ServerPing() error {
+	return c.serverPing(context.Background())
+}
+
+func (c *Client) serverPing(ctx context.Context) error {
 	switch c.Protocol {
 	case Protocol12:
 		fallthrough
 	case Protocol14:
 		fallthrough
 	case Protocol14_2:
-		res, err := c.syncRequest(c.req("server.ping"))
+		start := time.Now()
+		ctx, cancel := context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+		res, err := c.syncRequestContext(ctx, c.req("server.ping"))
 		if err != nil {
 			return err
 		}
 		if res.Error != nil {
-			return errors.New(res.Error.Message)
+			return res.Error
 		}
+		c.health.ping(time.Since(start))
 		return nil
 	default:
 		return ErrUnavailableMethod
@@ -539,19 +890,25 @@ func (c *Client) ServerPing() error {
 //
 // https://electrumx.readthedocs.io/en/latest/protocol-methods.html#server-version
 func (c *Client) ServerVersion() (*VersionInfo, error) {
-	res, err := c.syncRequest(c.req("server.version", c.agent, c.Protocol))
+	return c.serverVersion(context.Background())
+}
+
+func (c *Client) serverVersion(ctx context.Context) (*VersionInfo, error) {
+	res, err := c.syncRequestContext(ctx, c.req("server.version", c.agent, c.Protocol))
 	if err != nil {
 		return nil, err
 	}
 
 	if res.Error != nil {
-		return nil, errors.New(res.Error.Message)
+		return nil, res.Error
 	}
 
 	info := &VersionInfo{}
 	switch c.Protocol {
 	case Protocol10:
-		info.Software = res.Result.(string)
+		if err = decodeResult(res, &info.Software); err != nil {
+			return nil, err
+		}
 	case Protocol11:
 		fallthrough
 	case Protocol12:
@@ -560,12 +917,11 @@ func (c *Client) ServerVersion() (*VersionInfo, error) {
 		fallthrough
 	case Protocol14_2:
 		var d []string
-		b, err := json.Marshal(res.Result)
-		if err != nil {
+		if err = decodeResult(res, &d); err != nil {
 			return nil, err
 		}
-		if err = json.Unmarshal(b, &d); err != nil {
-			return nil, err
+		if len(d) != 2 {
+			return nil, fmt.Errorf("unexpected server version: %v", d)
 		}
 		info.Software = d[0]
 		info.Protocol = d[1]
@@ -582,11 +938,11 @@ func (c *Client) ServerBanner() (string, error) {
 		return "", err
 	}
 
-	if res.Error != nil {
-		return "", errors.New(res.Error.Message)
+	var result string
+	if err := decodeResult(res, &result); err != nil {
+		return "", err
 	}
-
-	return res.Result.(string), nil
+	return result, nil
 }
 
 // ServerDonationAddress will synchronously run a 'server.donation_address' operation
@@ -598,37 +954,40 @@ func (c *Client) ServerDonationAddress() (string, error) {
 		return "", err
 	}
 
-	if res.Error != nil {
-		return "", errors.New(res.Error.Message)
+	var result string
+	if err := decodeResult(res, &result); err != nil {
+		return "", err
 	}
-
-	return res.Result.(string), nil
+	return result, nil
 }
 
 // ServerFeatures returns a list of features and services supported by the server
 //
-// https://electrumx.readthedocs.io/en/latest/protocol-methods.html#server-donation-address
+// https://electrumx.readthedocs.io/en/latest/protocol-methods.html#server-features
 func (c *Client) ServerFeatures() (*ServerInfo, error) {
+	return c.serverFeatures(context.Background())
+}
+
+func (c *Client) serverFeatures(ctx context.Context) (*ServerInfo, error) {
 	info := new(ServerInfo)
 	switch c.Protocol {
 	case Protocol10:
 		return nil, ErrUnavailableMethod
 	default:
-		res, err := c.syncRequest(c.req("server.features"))
+		res, err := c.syncRequestContext(ctx, c.req("server.features"))
 		if err != nil {
 			return nil, err
 		}
 
 		if res.Error != nil {
-			return nil, errors.New(res.Error.Message)
+			return nil, res.Error
 		}
 
-		b, err := json.Marshal(res.Result)
-		if err != nil {
+		if err = decodeObject(res, info); err != nil {
 			return nil, err
 		}
-		if err = json.Unmarshal(b, &info); err != nil {
-			return nil, err
+		if info.GenesisHash == "" {
+			return nil, errors.New("server features missing genesis hash")
 		}
 	}
 	return info, nil
@@ -637,38 +996,44 @@ func (c *Client) ServerFeatures() (*ServerInfo, error) {
 // ServerPeers returns a list of peer servers
 //
 // https://electrumx.readthedocs.io/en/latest/protocol-methods.html#server-peers-subscribe
-func (c *Client) ServerPeers() (peers []*Peer, err error) {
-	res, err := c.syncRequest(c.req("server.peers.subscribe"))
+func (c *Client) ServerPeers() ([]*Peer, error) {
+	return c.serverPeers(context.Background())
+}
+
+func (c *Client) serverPeers(ctx context.Context) (peers []*Peer, err error) {
+	res, err := c.syncRequestContext(ctx, c.req("server.peers.subscribe"))
 	if err != nil {
 		return
 	}
 
 	if res.Error != nil {
-		err = errors.New(res.Error.Message)
+		err = res.Error
 		return
 	}
 
-	var list []interface{}
-	b, err := json.Marshal(res.Result)
-	if err != nil {
-		return
-	}
-	if err = json.Unmarshal(b, &list); err != nil {
+	return decodePeers(res)
+}
+
+// Decode the peers reported by the server, entries are [ip, hostname, features] tuples;
+// malformed ones are skipped
+func decodePeers(res *response) (peers []*Peer, err error) {
+	var list []json.RawMessage
+	if err = decodeResult(res, &list); err != nil {
 		return
 	}
 
 	for _, l := range list {
-		p := &Peer{
-			Address: l.([]interface{})[0].(string),
-			Name:    l.([]interface{})[1].(string),
-		}
-		b, err := json.Marshal(l.([]interface{})[2])
-		if err != nil {
+		var entry []json.RawMessage
+		if json.Unmarshal(l, &entry) != nil || len(entry) < 3 {
 			continue
 		}
-		if err = json.Unmarshal(b, &p.Features); err != nil {
+		p := new(Peer)
+		if json.Unmarshal(entry[0], &p.Address) != nil ||
+			json.Unmarshal(entry[1], &p.Name) != nil ||
+			json.Unmarshal(entry[2], &p.Features) != nil {
 			continue
 		}
+		p.parseFeatures()
 		peers = append(peers, p)
 	}
 	return
@@ -678,23 +1043,24 @@ func (c *Client) ServerPeers() (peers []*Peer, err error) {
 //
 // https://electrumx.readthedocs.io/en/latest/protocol-methods.html#blockchain-scripthash-get-balance
 func (c *Client) ScriptHashBalance(scriptHash string) (*Balance, error) {
+	return c.ScriptHashBalanceContext(context.Background(), scriptHash)
+}
+
+// ScriptHashBalanceContext is like 'ScriptHashBalance', the request is dispatched within
+// the context and at its priority, see 'WithPriority'
+func (c *Client) ScriptHashBalanceContext(ctx context.Context, scriptHash string) (*Balance, error) {
 	balance := new(Balance)
 
-	res, err := c.syncRequest(c.req("blockchain.scripthash.get_balance", scriptHash))
+	res, err := c.syncRequestContext(ctx, c.req("blockchain.scripthash.get_balance", scriptHash))
 	if err != nil {
 		return nil, fmt.Errorf("error getting balance for scripthash %s: %w", scriptHash, err)
 	}
 
 	if res.Error != nil {
-		return nil, fmt.Errorf("error getting balance for scripthash %s: %w", scriptHash, errors.New(res.Error.Message))
-	}
-
-	b, err := json.Marshal(res.Result)
-	if err != nil {
-		return nil, fmt.Errorf("error getting balance for scripthash %s: %w", scriptHash, err)
+		return nil, fmt.Errorf("error getting balance for scripthash %s: %w", scriptHash, res.Error)
 	}
 
-	if err = json.Unmarshal(b, balance); err != nil {
+	if err = decodeObject(res, balance); err != nil {
 		return nil, fmt.Errorf("error getting balance for scripthash %s: %w", scriptHash, err)
 	}
 
@@ -705,23 +1071,31 @@ func (c *Client) ScriptHashBalance(scriptHash string) (*Balance, error) {
 //
 // https://electrumx.readthedocs.io/en/latest/protocol-methods.html#blockchain-scripthash-get-history
 func (c *Client) ScriptHashHistory(scriptHash string) ([]Tx, error) {
+	return c.ScriptHashHistoryContext(context.Background(), scriptHash)
+}
+
+// ScriptHashHistoryContext is like 'ScriptHashHistory', the requests are dispatched within
+// the context and at its priority, see 'WithPriority'
+func (c *Client) ScriptHashHistoryContext(ctx context.Context, scriptHash string) ([]Tx, error) {
+	if c.cacheHistories {
+		return c.cachedScriptHashHistory(ctx, scriptHash)
+	}
+	return c.scriptHashHistory(ctx, scriptHash)
+}
+
+func (c *Client) scriptHashHistory(ctx context.Context, scriptHash string) ([]Tx, error) {
 	list := []Tx{}
 
-	res, err := c.syncRequest(c.req("blockchain.scripthash.get_history", scriptHash))
+	res, err := c.syncRequestContext(ctx, c.req("blockchain.scripthash.get_history", scriptHash))
 	if err != nil {
 		return nil, fmt.Errorf("error getting history for scripthash %s: %w", scriptHash, err)
 	}
 
 	if res.Error != nil {
-		return nil, fmt.Errorf("error getting history for scripthash %s: %w", scriptHash, errors.New(res.Error.Message))
+		return nil, fmt.Errorf("error getting history for scripthash %s: %w", scriptHash, res.Error)
 	}
 
-	b, err := json.Marshal(res.Result)
-	if err != nil {
-		return nil, fmt.Errorf("error getting history for scripthash %s: %w", scriptHash, err)
-	}
-
-	if err = json.Unmarshal(b, &list); err != nil {
+	if err = decodeResult(res, &list); err != nil {
 		return nil, fmt.Errorf("error getting history for scripthash %s: %w", scriptHash, err)
 	}
 
@@ -732,23 +1106,25 @@ func (c *Client) ScriptHashHistory(scriptHash string) ([]Tx, error) {
 //
 // https://electrumx.readthedocs.io/en/latest/protocol-methods.html#blockchain-scripthash-get-mempool
 func (c *Client) ScriptHashMempool(scripthash string) ([]MempoolTx, error) {
+	return c.ScriptHashMempoolContext(context.Background(), scripthash)
+}
+
+// ScriptHashMempoolContext is like 'ScriptHashMempool', the request is dispatched within
+// the context and at its priority, see 'WithPriority'
+func (c *Client) ScriptHashMempoolContext(ctx context.Context, scripthash string) ([]MempoolTx, error) {
 	list := []MempoolTx{}
 
-	res, err := c.syncRequest(c.req("blockchain.scripthash.get_mempool", scripthash))
+	res, err := c.syncRequestContext(ctx, c.req("blockchain.scripthash.get_mempool", scripthash))
 	if err != nil {
 		return nil, fmt.Errorf("error getting mempool for scripthash %s: %w", scripthash, err)
 	}
 
 	if res.Error != nil {
-		err = errors.New(res.Error.Message)
+		err = res.Error
 		return nil, fmt.Errorf("error getting mempool for scripthash %s: %w", scripthash, err)
 	}
 
-	b, err := json.Marshal(res.Result)
-	if err != nil {
-		return nil, fmt.Errorf("error getting mempool for scripthash %s: %w", scripthash, err)
-	}
-	if err = json.Unmarshal(b, &list); err != nil {
+	if err = decodeResult(res, &list); err != nil {
 		return nil, fmt.Errorf("error getting mempool for scripthash %s: %w", scripthash, err)
 	}
 	return list, nil
@@ -758,23 +1134,25 @@ func (c *Client) ScriptHashMempool(scripthash string) ([]MempoolTx, error) {
 //
 // https://electrumx.readthedocs.io/en/latest/protocol-methods.html#blockchain-scripthash-listunspent
 func (c *Client) ScriptHashListUnspent(scripthash string) ([]UnspentTx, error) {
+	return c.ScriptHashListUnspentContext(context.Background(), scripthash)
+}
+
+// ScriptHashListUnspentContext is like 'ScriptHashListUnspent', the request is dispatched
+// within the context and at its priority, see 'WithPriority'
+func (c *Client) ScriptHashListUnspentContext(ctx context.Context, scripthash string) ([]UnspentTx, error) {
 	list := []UnspentTx{}
 
-	res, err := c.syncRequest(c.req("blockchain.scripthash.listunspent", scripthash))
+	res, err := c.syncRequestContext(ctx, c.req("blockchain.scripthash.listunspent", scripthash))
 	if err != nil {
 		return nil, fmt.Errorf("error getting listunspent for scripthash %s: %w", scripthash, err)
 	}
 
 	if res.Error != nil {
-		err = errors.New(res.Error.Message)
+		err = res.Error
 		return nil, fmt.Errorf("error getting listunspent for scripthash %s: %w", scripthash, err)
 	}
 
-	b, err := json.Marshal(res.Result)
-	if err != nil {
-		return nil, fmt.Errorf("error getting listunspent for scripthash %s: %w", scripthash, err)
-	}
-	if err = json.Unmarshal(b, &list); err != nil {
+	if err = decodeResult(res, &list); err != nil {
 		return nil, fmt.Errorf("error getting listunspent for scripthash %s: %w", scripthash, err)
 	}
 	return list, nil
@@ -785,27 +1163,37 @@ func (c *Client) ScriptHashListUnspent(scripthash string) ([]UnspentTx, error) {
 // https://electrumx.readthedocs.io/en/latest/protocol-methods.html#blockchain-block-header
 
 func (c *Client) BlockHeader(index int) (header *BlockHeader, err error) {
+	key := strconv.Itoa(index)
+	header = new(BlockHeader)
+	if c.txCache.LoadItem(itemCheckpoint, key, header) {
+		return header, nil
+	}
+	defer func() {
+		if err == nil {
+			// The proof is relative to the checkpoint at the next height
+			c.storeItem(itemCheckpoint, key, int64(index)+1, header)
+		}
+	}()
+
 	res, err := c.syncRequest(c.req("blockchain.block.header", index, index+1))
 	if err != nil {
 		return
 	}
 
 	if res.Error != nil {
-		err = errors.New(res.Error.Message)
+		err = res.Error
 		return
 	}
 
-	b, err := json.Marshal(res.Result)
-	if err != nil {
-		return
-	}
-	if err = json.Unmarshal(b, &header); err != nil {
+	if err = decodeObject(res, header); err != nil {
 		return
 	}
 	return
 }
 
-// BroadcastTransaction will synchronously run a 'blockchain.transaction.broadcast' operation
+// BroadcastTransaction will synchronously run a 'blockchain.transaction.broadcast' operation;
+// transactions rejected by the daemon are reported with a *BroadcastError describing the
+// reason, other server errors are returned as they are
 //
 // https://electrumx.readthedocs.io/en/latest/protocol-methods.html#blockchain-transaction-broadcast
 func (c *Client) BroadcastTransaction(hex string) (string, error) {
@@ -814,11 +1202,27 @@ func (c *Client) BroadcastTransaction(hex string) (string, error) {
 		return "", err
 	}
 
-	if res.Result == nil || strings.Contains(res.Result.(string), "rejected") {
-		return "", ErrRejectedTx
+	if res.Error != nil {
+		if isRejection(res.Error) {
+			return "", newBroadcastError(res.Error.Message, res.Error)
+		}
+		return "", fmt.Errorf("error broadcasting transaction: %w", res.Error)
+	}
+
+	var txID string
+	if err := decodeResult(res, &txID); err != nil {
+		return "", fmt.Errorf("error broadcasting transaction: %w", err)
+	}
+	if txID == "" {
+		return "", fmt.Errorf("error broadcasting transaction: %w", ErrMissingResponse)
 	}
 
-	return res.Result.(string), nil
+	// Older servers report rejections as the result
+	if strings.Contains(txID, "rejected") {
+		return "", newBroadcastError(txID, nil)
+	}
+
+	return txID, nil
 }
 
 // GetTransaction will synchronously run a 'blockchain.transaction.get' operation
@@ -830,17 +1234,17 @@ func (c *Client) GetTransaction(hash string) (string, error) {
 		return "", err
 	}
 
-	if res.Error != nil {
-		return "", errors.New(res.Error.Message)
+	var result string
+	if err := decodeResult(res, &result); err != nil {
+		return "", err
 	}
-
-	return res.Result.(string), nil
+	return result, nil
 }
 
 func (c *Client) GetVerboseTransaction(hash string) (*VerboseTx, error) {
 	tx := new(VerboseTx)
 
-	if ok := c.txCache.Load(hash, tx); ok {
+	if ok := c.loadTx(hash, tx); ok {
 		c.debug("Tx %s found in cache", hash)
 		return tx, nil
 	}
@@ -851,84 +1255,112 @@ func (c *Client) GetVerboseTransaction(hash string) (*VerboseTx, error) {
 	}
 
 	if res.Error != nil {
-		return nil, fmt.Errorf("error getting verbose transaction %s: %w", hash, errors.New(res.Error.Message))
+		return nil, fmt.Errorf("error getting verbose transaction %s: %w", hash, res.Error)
 	}
 
-	b, err := json.Marshal(res.Result)
-	if err != nil {
+	if err = decodeObject(res, tx); err != nil {
 		return nil, fmt.Errorf("error getting verbose transaction %s: %w", hash, err)
 	}
 
-	if err = json.Unmarshal(b, tx); err != nil {
-		return nil, fmt.Errorf("error getting verbose transaction %s: %w", hash, err)
-	}
-
-	if tx.Confirmations > 0 {
-		err := c.txCache.Store(hash, *tx)
-		if err != nil {
-			c.error("Store tx %s in cache failed: %v", hash, err)
-		}
-	}
+	c.storeTx(hash, tx)
 
 	return tx, nil
 }
 
-// EstimateFee will synchronously run a 'blockchain.estimatefee' operation
+// EstimateFee will synchronously run a 'blockchain.estimatefee' operation, returning the
+// fee rate in BTC/kB; ErrNoFeeEstimate is returned when the server is unable to estimate
+// a rate for the given number of blocks
 //
 // https://electrumx.readthedocs.io/en/latest/protocol-methods.html#blockchain-estimatefee
 func (c *Client) EstimateFee(blocks int) (float64, error) {
-	res, err := c.syncRequest(c.req("blockchain.estimatefee", strconv.Itoa(blocks)))
+	res, err := c.syncRequest(c.req("blockchain.estimatefee", blocks))
 	if err != nil {
 		return 0, err
 	}
 
-	if res.Error != nil {
-		return 0, errors.New(res.Error.Message)
+	var fee float64
+	if err := decodeResult(res, &fee); err != nil {
+		return 0, err
 	}
-
-	return res.Result.(float64), nil
+	if fee < 0 {
+		return 0, ErrNoFeeEstimate
+	}
+	return fee, nil
 }
 
 // TransactionMerkle will synchronously run a 'blockchain.transaction.get_merkle' operation
 //
 // https://electrumx.readthedocs.io/en/latest/protocol-methods.html#blockchain-transaction-get-merkle
 func (c *Client) TransactionMerkle(tx string, height int) (tm *TxMerkle, err error) {
+	key := merkleKey(tx, int64(height))
+	tm = new(TxMerkle)
+	if c.txCache.LoadItem(itemMerkle, key, tm) {
+		return tm, nil
+	}
+	defer func() {
+		if err == nil {
+			c.storeItem(itemMerkle, key, int64(height), tm)
+		}
+	}()
+
 	res, err := c.syncRequest(c.req("blockchain.transaction.get_merkle", tx, strconv.Itoa(height)))
 	if err != nil {
 		return
 	}
 
 	if res.Error != nil {
-		err = errors.New(res.Error.Message)
+		err = res.Error
 		return
 	}
 
-	b, err := json.Marshal(res.Result)
-	if err != nil {
-		return
-	}
-	if err = json.Unmarshal(b, &tm); err != nil {
+	if err = decodeObject(res, tm); err != nil {
 		return
 	}
 	return
 }
 
-// GetVerboseTransactionBatch gets the VerboseTx from a batch of transactions.
+// GetVerboseTransactionBatch gets the VerboseTx from a batch of transactions; the whole batch
+// fails if any of the transactions can't be retrieved
 func (c *Client) GetVerboseTransactionBatch(
 	hashes []string,
 ) ([]*VerboseTx, error) {
-	txs := make([]*VerboseTx, len(hashes))
+	results, err := c.GetVerboseTransactionBatchResults(hashes)
+	if err != nil {
+		return nil, err
+	}
+
+	txs := make([]*VerboseTx, len(results))
+	for i, r := range results {
+		if r.Err != nil {
+			return nil, r.Err
+		}
+		txs[i] = r.Tx
+	}
+
+	return txs, nil
+}
+
+// GetVerboseTransactionBatchResults gets the VerboseTx from a batch of transactions, reporting
+// the outcome of each one individually. Failures of single entries are returned as a *TxError,
+// the returned error is only set when the batch can't be dispatched at all
+func (c *Client) GetVerboseTransactionBatchResults(
+	hashes []string,
+) ([]TxResult, error) {
+	return c.verboseTransactionBatchResults(context.Background(), hashes)
+}
+
+func (c *Client) verboseTransactionBatchResults(ctx context.Context, hashes []string) ([]TxResult, error) {
+	results := make([]TxResult, len(hashes))
 
 	params := make([][]any, 0, len(hashes))
 
 	paramsMap := make(map[int]int, len(hashes))
 
+	cached := c.loadTxs(hashes)
 	for i, hash := range hashes {
-		tx := new(VerboseTx)
-
 		// if tx is in cache, use it
-		if ok := c.txCache.Load(hash, tx); ok {
-			txs[i] = tx
+		if tx, ok := cached[hash]; ok {
+			results[i].Tx = tx
 
 			continue
 		}
@@ -939,81 +1371,145 @@ func (c *Client) GetVerboseTransactionBatch(
 	}
 
 	if len(params) == 0 {
-		return txs, nil
+		return results, nil
 	}
 
-	res, err := c.syncBatchRequest(c.batchReq("blockchain.transaction.get", params))
+	res, err := c.syncBatchRequest(ctx, c.batchReq("blockchain.transaction.get", params))
 	if err != nil {
 		return nil, err
 	}
 
+	fetched := make([]*VerboseTx, 0, len(res))
 	for i, r := range res {
-		if r.Error != nil {
-			return nil, errors.New(r.Error.Message)
-		}
+		hash := hashes[paramsMap[i]]
 
 		tx := new(VerboseTx)
-
-		b, err := json.Marshal(r.Result)
-		if err != nil {
-			return nil, err
+		if err := decodeObject(r, tx); err != nil {
+			results[paramsMap[i]].Err = newTxError(hash, r, err)
+			continue
 		}
 
-		if err = json.Unmarshal(b, tx); err != nil {
-			return nil, err
-		}
+		results[paramsMap[i]].Tx = tx
+		fetched = append(fetched, tx)
+	}
+	c.storeTxs(fetched)
 
-		txs[paramsMap[i]] = tx
+	return results, nil
+}
 
-		if tx.Confirmations > 0 {
-			err := c.txCache.Store(tx.TxID, *tx)
-			if err != nil {
-				c.error("Store tx %s in cache failed: %v", tx.TxID, err)
-			}
+// Fetch any number of verbose transactions, failing if any of them can't be retrieved
+func (c *Client) getVerboseTransactions(hashes []string) ([]*VerboseTx, error) {
+	results := c.fetchVerboseTransactions(context.Background(), hashes)
+
+	txs := make([]*VerboseTx, len(results))
+	for i, r := range results {
+		if r.Err != nil {
+			return nil, r.Err
 		}
+		txs[i] = r.Tx
 	}
-
 	return txs, nil
 }
 
-func (c *Client) EnrichVin(vins []Vin) ([]VinWithPrevout, error) {
-	hashes := make([]string, len(vins))
-
-	for i, vin := range vins {
-		hashes[i] = vin.TxID
+// Fetch any number of verbose transactions. Duplicated hashes are requested only once,
+// batches of at most 'MaxBatchSize' entries are dispatched concurrently and requests already
+// in-flight, e.g. from concurrent 'EnrichTransaction' calls, are reused. Batches are sent
+// within the context and at its priority; once it's done, the pending results report its error
+func (c *Client) fetchVerboseTransactions(ctx context.Context, hashes []string) []TxResult {
+	calls := make(map[string]*txCall, len(hashes))
+	owned := make(map[string]bool)
+	var fetch []string
+
+	c.inflightMu.Lock()
+	for _, hash := range hashes {
+		if _, ok := calls[hash]; ok {
+			continue
+		}
+		call, ok := c.inflight[hash]
+		if !ok {
+			call = &txCall{done: make(chan struct{})}
+			c.inflight[hash] = call
+			fetch = append(fetch, hash)
+			owned[hash] = true
+		}
+		calls[hash] = call
 	}
+	c.inflightMu.Unlock()
 
-	vinWithPrevouts := make([]VinWithPrevout, len(vins))
-
-	for i := 0; i <= len(hashes)/int(c.maxBatchSize); i++ {
-		start := i * int(c.maxBatchSize)
-
+	sem := make(chan struct{}, c.batchConcurrency)
+	for start := 0; start < len(fetch); start += int(c.maxBatchSize) {
 		end := start + int(c.maxBatchSize)
-
-		if end > len(hashes) {
-			end = len(hashes)
+		if end > len(fetch) {
+			end = len(fetch)
 		}
 
-		batchHashes := hashes[start:end]
-		if len(batchHashes) == 0 {
-			break
-		}
+		batch := fetch[start:end]
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem }()
+			results, err := c.verboseTransactionBatchResults(ctx, batch)
+
+			c.inflightMu.Lock()
+			defer c.inflightMu.Unlock()
+			for i, hash := range batch {
+				call := calls[hash]
+				if err != nil {
+					call.Err = err
+				} else {
+					call.TxResult = results[i]
+				}
+				delete(c.inflight, hash)
+				close(call.done)
+			}
+		}()
+	}
 
-		txs, err := c.GetVerboseTransactionBatch(batchHashes)
-		if err != nil {
-			return nil, err
+	// Requests reused from other callers may have been given up along with their context,
+	// those are retried
+	results := make([]TxResult, len(hashes))
+	var retry []int
+	for i, hash := range hashes {
+		call := calls[hash]
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			results[i].Err = ctx.Err()
+			continue
 		}
-
-		for j, tx := range txs {
-			vinIndex := start + j
-			vinWithPrevouts[vinIndex] = VinWithPrevout{
-				Vin:     &vins[vinIndex],
-				Prevout: &tx.Vout[vins[vinIndex].Vout],
-			}
+		results[i] = call.TxResult
+		if !owned[hash] && ctx.Err() == nil &&
+			(errors.Is(call.Err, context.Canceled) || errors.Is(call.Err, context.DeadlineExceeded)) {
+			retry = append(retry, i)
 		}
 	}
+	if len(retry) > 0 {
+		again := make([]string, len(retry))
+		for j, i := range retry {
+			again[j] = hashes[i]
+		}
+		for j, r := range c.fetchVerboseTransactions(ctx, again) {
+			results[retry[j]] = r
+		}
+	}
+	return results
+}
 
-	return vinWithPrevouts, nil
+// EnrichVin resolves the previous output spent by each input; coinbase inputs don't spend
+// an existing output and are marked as such with a nil prevout
+func (c *Client) EnrichVin(vins []Vin) ([]VinWithPrevout, error) {
+	hashes := prevoutHashes(vins)
+
+	txs, err := c.getVerboseTransactions(hashes)
+	if err != nil {
+		return nil, err
+	}
+
+	parents := make(map[string]*VerboseTx, len(txs))
+	for i, tx := range txs {
+		parents[hashes[i]] = tx
+	}
+
+	return linkPrevouts(vins, parents)
 }
 
 // Details a transaction by adding Prevout to Vin.
@@ -1028,25 +1524,70 @@ func (c *Client) EnrichTransaction(tx *VerboseTx, blockHeight int64) (*RichTx, e
 		Fee:          0,
 	}
 
-	if ok := c.txCache.Load(tx.TxID, &richTx); ok {
+	if ok := c.loadTx(tx.TxID, &richTx); ok {
 		return &richTx, nil
 	}
 
-	// set tx merkle
-	tm, err := c.TransactionMerkle(tx.TxID, int(blockHeight))
-	if err != nil {
-		return nil, err
+	// set tx merkle, transactions still in the mempool have no merkle proof yet
+	var tm *TxMerkle
+	if blockHeight > 0 {
+		var err error
+		if tm, err = c.TransactionMerkle(tx.TxID, int(blockHeight)); err != nil {
+			return nil, err
+		}
 	}
 
-	richTx.Merkle = *tm
-
 	// enrich vin
 	vinWithPrevouts, err := c.EnrichVin(tx.Vin)
 	if err != nil {
 		return nil, err
 	}
 
-	richTx.Vin = vinWithPrevouts
+	return c.buildRichTx(tx, blockHeight, tm, vinWithPrevouts), nil
+}
+
+// Transaction IDs of all the outputs spent by the inputs, skipping coinbase inputs
+func prevoutHashes(vins []Vin) []string {
+	hashes := make([]string, 0, len(vins))
+	for i := range vins {
+		if !isCoinbase(&vins[i]) {
+			hashes = append(hashes, vins[i].TxID)
+		}
+	}
+	return hashes
+}
+
+// Attach to each input the output it spends, taken from the already resolved parent transactions
+func linkPrevouts(vins []Vin, parents map[string]*VerboseTx) ([]VinWithPrevout, error) {
+	vinWithPrevouts := make([]VinWithPrevout, len(vins))
+	for i := range vins {
+		vin := &vins[i]
+		vinWithPrevouts[i] = VinWithPrevout{Vin: vin}
+		if isCoinbase(vin) {
+			vinWithPrevouts[i].IsCoinbase = true
+			continue
+		}
+
+		tx, ok := parents[vin.TxID]
+		if !ok || int(vin.Vout) >= len(tx.Vout) {
+			return nil, fmt.Errorf("error enriching input %s:%d: output not found", vin.TxID, vin.Vout)
+		}
+		vinWithPrevouts[i].Prevout = &tx.Vout[vin.Vout]
+	}
+	return vinWithPrevouts, nil
+}
+
+// Calculate the totals and fee of an enriched transaction and store it in the cache
+func (c *Client) buildRichTx(tx *VerboseTx, blockHeight int64, tm *TxMerkle, vins []VinWithPrevout) *RichTx {
+	richTx := RichTx{
+		VerboseTx: *tx,
+		Vin:       vins,
+		Height:    blockHeight,
+	}
+
+	if tm != nil {
+		richTx.Merkle = *tm
+	}
 
 	// calculate inputsTotal
 	for _, vout := range tx.Vout {
@@ -1054,21 +1595,29 @@ func (c *Client) EnrichTransaction(tx *VerboseTx, blockHeight int64) (*RichTx, e
 	}
 	richTx.OutputsTotal = Round8(richTx.OutputsTotal)
 
-	// calculate outputsTotal
+	// calculate outputsTotal, coinbase inputs don't contribute any value
+	coinbase := false
 	for _, vin := range richTx.Vin {
+		if vin.IsCoinbase {
+			coinbase = true
+			continue
+		}
 		richTx.InputsTotal += vin.Prevout.Value
 	}
 
 	richTx.InputsTotal = Round8(richTx.InputsTotal)
 
 	// calculate fee
-	richTx.Fee = Round8(richTx.InputsTotal - richTx.OutputsTotal)
-	richTx.FeeInSat = int64(richTx.Fee * BitcoinBase)
-
-	err = c.txCache.Store(tx.TxID, richTx)
-	if err != nil {
-		c.error("Store detailedTx %s in cache failed: %v", tx.TxID, err)
+	switch {
+	case !coinbase:
+		richTx.Fee = Round8(richTx.InputsTotal - richTx.OutputsTotal)
+		richTx.FeeInSat = int64(richTx.Fee * BitcoinBase)
+	case c.coinbaseFee == CoinbaseFeeSubsidy:
+		richTx.FeeInSat = BlockSubsidy(blockHeight)
+		richTx.Fee = Round8(float64(richTx.FeeInSat) / BitcoinBase)
 	}
 
-	return &richTx, nil
+	c.storeTx(tx.TxID, &richTx)
+
+	return &richTx
 }
@@ -3,12 +3,14 @@ package electrum
 import (
 	"context"
 	"crypto/tls"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"log/slog"
 	"os"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -415,3 +417,123 @@ func ExampleClient_EnrichVin() {
 	// 0.02930787 7aeb3f74c796b0637b4c06a8034315f698f9bc45e63eaebb4de6e8425dee4223
 	// 0.02 b832e427e4f2104f400929e0b44db4c315e1d158dfe3e90b8eac616278681366
 }
+
+func TestEnrichVinFetching(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests = map[string]int{}
+		active   int
+		peak     int
+		started  = make(chan struct{}, 100)
+		release  = make(chan struct{})
+	)
+	client := newMockClient(t, &Options{MaxBatchSize: 2, MaxConcurrentBatches: 2}, func(method string, params []json.RawMessage) (any, *RPCError) {
+		var hash string
+		if err := json.Unmarshal(params[0], &hash); err != nil {
+			return nil, &RPCError{Message: err.Error()}
+		}
+		mu.Lock()
+		requests[hash]++
+		active++
+		if active > peak {
+			peak = active
+		}
+		mu.Unlock()
+
+		started <- struct{}{}
+		<-release
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		active--
+		mu.Unlock()
+		return &VerboseTx{TxID: hash, Vout: []Vout{{N: 0, Value: 0.1}, {N: 1, Value: 0.2}}}, nil
+	})
+
+	var vins []Vin
+	for i := 0; i < 20; i++ {
+		vins = append(vins, Vin{TxID: fmt.Sprintf("%064d", i%10), Vout: uint32(i % 2)})
+	}
+
+	results := make([][]VinWithPrevout, 2)
+	errs := make([]error, 2)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = client.EnrichVin(vins)
+		}(i)
+
+		// Ensure the second call starts while the first one is in-flight
+		if i == 0 {
+			<-started
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	for i, res := range results {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		for j, vin := range res {
+			if vin.Prevout == nil || vin.Prevout.N != vins[j].Vout {
+				t.Errorf("unexpected prevout for input %d: %+v", j, vin.Prevout)
+			}
+		}
+	}
+	if len(requests) != 10 {
+		t.Errorf("expected 10 distinct parents, got %d", len(requests))
+	}
+	for hash, count := range requests {
+		if count != 1 {
+			t.Errorf("parent %s requested %d times", hash, count)
+		}
+	}
+	if peak > 2 {
+		t.Errorf("expected at most 2 concurrent batches, got %d", peak)
+	}
+}
+
+func TestGetVerboseTransactionBatchResults(t *testing.T) {
+	hashes := []string{
+		strings.Repeat("a", 64),
+		strings.Repeat("b", 64),
+		strings.Repeat("c", 64),
+		strings.Repeat("d", 64),
+	}
+	client := newMockClient(t, nil, func(method string, params []json.RawMessage) (any, *RPCError) {
+		var hash string
+		_ = json.Unmarshal(params[0], &hash)
+		switch hash {
+		case hashes[1]:
+			return nil, &RPCError{Code: 2, Message: "daemon error: DaemonError({'code': -5, 'message': 'No such mempool or blockchain transaction.'})"}
+		case hashes[2]:
+			return nil, &RPCError{Code: 2, Message: "daemon error: DaemonError({'code': -28, 'message': 'Loading block index...'})"}
+		case hashes[3]:
+			return mockSkip, nil
+		}
+		return &VerboseTx{TxID: hash}, nil
+	})
+
+	results, err := client.GetVerboseTransactionBatchResults(hashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Err != nil || results[0].Tx.TxID != hashes[0] {
+		t.Errorf("unexpected result: %+v", results[0])
+	}
+	for i, kind := range []error{ErrTxNotFound, ErrServerFailure, ErrMissingResponse} {
+		res := results[i+1]
+		var txErr *TxError
+		if !errors.Is(res.Err, kind) || !errors.As(res.Err, &txErr) || txErr.TxID != hashes[i+1] {
+			t.Errorf("expected %v for %s, got %v", kind, hashes[i+1], res.Err)
+		}
+	}
+
+	if _, err := client.GetVerboseTransactionBatch(hashes); !errors.Is(err, ErrTxNotFound) {
+		t.Errorf("expected the whole batch to fail, got %v", err)
+	}
+}
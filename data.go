@@ -42,6 +42,14 @@ type Peer struct {
 	Address  string   `json:"address"`
 	Name     string   `json:"name"`
 	Features []string `json:"features"`
+
+	// Parsed from the features: max supported version of the protocol, the ports
+	// available, zero if not supported, and the number of blocks of history kept,
+	// zero if not pruning
+	ProtocolMax string `json:"protocol_max,omitempty"`
+	SSLPort     uint   `json:"ssl_port,omitempty"`
+	TCPPort     uint   `json:"tcp_port,omitempty"`
+	Pruning     uint64 `json:"pruning,omitempty"`
 }
 
 // Tx represents a transaction entry on the blockchain
@@ -69,12 +77,18 @@ type VerboseTx struct {
 	Hex           string   `json:"hex"`
 	Locktime      uint32   `json:"locktime"`
 	Size          uint32   `json:"size"`
+	VSize         uint32   `json:"vsize"`
+	Weight        uint32   `json:"weight"`
 	Time          uint64   `json:"time"`
 	TxID          string   `json:"txid"`
 	Version       uint32   `json:"version"`
 	Vin           []Vin    `json:"vin"`
 	Vout          []Vout   `json:"vout"`
 	Merkle        TxMerkle `json:"merkle,omitempty"` // For protocol v1.5 and up.
+
+	// Height of the block including the transaction; not reported by the server,
+	// derived from the chain tip when the transaction is cached
+	Height int64 `json:"height,omitempty"`
 }
 
 // ScriptPubKey represents the script of that transaction output.
@@ -109,9 +123,12 @@ type Vin struct {
 	Vout      uint32    `json:"vout"`
 }
 
+// VinWithPrevout represents a transaction input along with the output it spends;
+// coinbase inputs don't spend any output and have a nil prevout
 type VinWithPrevout struct {
 	*Vin
-	Prevout *Vout `json:"prevout"`
+	Prevout    *Vout `json:"prevout"`
+	IsCoinbase bool  `json:"is_coinbase,omitempty"`
 }
 
 // RichTx represents a transaction entry on the blockchain with VinWithPrevout
@@ -125,6 +142,12 @@ type RichTx struct {
 	Fee          float64          `json:"fee,omitempty"`
 }
 
+// TxResult holds the outcome of retrieving a single transaction in a batch
+type TxResult struct {
+	Tx  *VerboseTx
+	Err error
+}
+
 // TxMerkle provides the merkle branch of a given transaction
 type TxMerkle struct {
 	BlockHeight float64  `json:"block_height"`
@@ -144,6 +167,10 @@ type BlockHeader struct {
 	Branch []string `json:"branch"`
 	Header string   `json:"header"`
 	Root   string   `json:"root"`
+
+	// Provided by 'blockchain.headers.subscribe'
+	Height int64  `json:"height,omitempty"`
+	Hex    string `json:"hex,omitempty"`
 }
 
 type BlockHanders struct {
@@ -154,22 +181,24 @@ type BlockHanders struct {
 	Root    string   `json:"root,omitempty"`
 }
 
-// RPC error
-type rpcError struct {
-	Code    int64                  `json:"code"`
-	Message string                 `json:"message"`
-	Data    map[string]interface{} `json:"data"`
+// RPCError is an error reported by the server; use 'errors.As' to access its code and
+// data, or 'errors.Is' with ErrBadRequest, ErrDaemonError, ErrExcessiveResourceUsage,
+// ErrServerBusy or ErrUnavailableMethod to classify it
+type RPCError struct {
+	Code    int64  `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
 }
 
 // Protocol response structure
 // http://docs.electrum.org/en/latest/protocol.html#response
 type response struct {
-	RPC    string      `json:"jsonrpc"`
-	ID     int         `json:"id"`
-	Method string      `json:"method"`
-	Params interface{} `json:"params"`
-	Result interface{} `json:"result"`
-	Error  *rpcError   `json:"error"`
+	RPC    string          `json:"jsonrpc"`
+	ID     int             `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *RPCError       `json:"error"`
 }
 
 // Protocol request structure
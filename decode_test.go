@@ -0,0 +1,107 @@
+package electrum
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestDecodeMessage(t *testing.T) {
+	responses, batch, err := decodeMessage([]byte(" \t[{\"id\":1,\"result\":{\"confirmed\":5}},{\"id\":2,\"error\":{\"code\":1,\"message\":\"bad\"}}]\n"))
+	if err != nil || !batch || len(responses) != 2 {
+		t.Fatalf("unexpected batch %+v: %v", responses, err)
+	}
+	balance := new(Balance)
+	if err := decodeResult(responses[0], balance); err != nil || balance.Confirmed != 5 {
+		t.Errorf("unexpected result %+v: %v", balance, err)
+	}
+	if err := decodeResult(responses[1], balance); err == nil || err.Error() != "bad" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	responses, batch, err = decodeMessage([]byte(`{"id":3,"result":"banner"}`))
+	if err != nil || batch || responses[0].ID != 3 || string(responses[0].Result) != `"banner"` {
+		t.Fatalf("unexpected response %+v: %v", responses, err)
+	}
+
+	if _, _, err := decodeMessage([]byte(`[null]`)); err == nil {
+		t.Error("expected an error for a null batch entry")
+	}
+
+	var raw json.RawMessage
+	if err := decodeResult(&response{}, &raw); err != nil || raw != nil {
+		t.Errorf("expected a missing result to leave the value untouched: %s", raw)
+	}
+}
+
+func TestNullResult(t *testing.T) {
+	client := newMockClient(t, nil, func(method string, params []json.RawMessage) (any, *RPCError) {
+		return json.RawMessage("null"), nil
+	})
+
+	if header, err := client.BlockHeader(1); !errors.Is(err, ErrMissingResponse) {
+		t.Errorf("unexpected header %+v: %v", header, err)
+	}
+	if tm, err := client.TransactionMerkle("aa", 1); !errors.Is(err, ErrMissingResponse) {
+		t.Errorf("unexpected merkle %+v: %v", tm, err)
+	}
+	if tx, err := client.GetVerboseTransaction("aa"); !errors.Is(err, ErrMissingResponse) {
+		t.Errorf("unexpected transaction %+v: %v", tx, err)
+	}
+	if _, err := client.EnrichTransaction(&VerboseTx{TxID: "aa", Vin: []Vin{{TxID: "bb"}}}, 1); err == nil {
+		t.Error("expected an error enriching a transaction without a response")
+	}
+}
+
+func FuzzDecodeMessage(f *testing.F) {
+	seeds := []string{
+		`{"jsonrpc":"2.0","id":1,"result":"banner"}`,
+		`{"jsonrpc":"2.0","id":1,"result":1.5e-05}`,
+		`{"jsonrpc":"2.0","id":1,"result":null}`,
+		`{"jsonrpc":"2.0","id":1,"error":{"code":-101,"message":"excessive resource usage","data":[1]}}`,
+		`{"jsonrpc":"2.0","id":1,"result":[["1.2.3.4","host",["v1.4","s50002"]],["bad"],[1,2,3]]}`,
+		`{"jsonrpc":"2.0","id":1,"result":{"txid":"aa","vin":[{"txid":"bb","vout":0}],"vout":[{"value":0.1,"n":0}]}}`,
+		`{"jsonrpc":"2.0","method":"blockchain.headers.subscribe","params":[{"height":1,"hex":"00"}]}`,
+		`[{"jsonrpc":"2.0","id":1,"result":{"confirmed":1,"unconfirmed":0}},{"jsonrpc":"2.0","id":2,"result":[{"tx_hash":"aa","height":1}]}]`,
+		`[null]`,
+		`["x", 1]`,
+	}
+	for _, seed := range seeds {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, m []byte) {
+		responses, _, err := decodeMessage(m)
+		if err != nil {
+			return
+		}
+		for _, res := range responses {
+			targets := []any{
+				new(string),
+				new(float64),
+				new([]string),
+				new(VerboseTx),
+				new(BlockHeader),
+				new(Balance),
+				new(TxMerkle),
+				new(ServerInfo),
+				new([]Tx),
+				new([]MempoolTx),
+				new([]UnspentTx),
+			}
+			for _, v := range targets {
+				_ = decodeResult(res, v)
+			}
+
+			// Objects decoded successfully are never nil
+			header, merkle, info := new(BlockHeader), new(TxMerkle), new(ServerInfo)
+			for _, v := range []any{&header, &merkle, &info} {
+				if decodeObject(res, v) == nil && (header == nil || merkle == nil || info == nil) {
+					t.Fatalf("nil object decoded from %s", res.Result)
+				}
+			}
+			_, _ = decodePeers(res)
+			_ = res.Error != nil && res.Error.Error() != ""
+		}
+	})
+}
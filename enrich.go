@@ -0,0 +1,183 @@
+package electrum
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// TxRef identifies a transaction and the height of the block including it; entries
+// returned by 'ScriptHashHistory' can be used directly
+type TxRef = Tx
+
+// EnrichResult holds the outcome of enriching a single transaction
+type EnrichResult struct {
+	Tx  *RichTx
+	Err error
+}
+
+// EnrichTransactions enriches many transactions at once. Verbose transactions and merkle
+// proofs of those already confirmed are requested together, and the outputs spent by all the
+// transactions are resolved afterwards, both using as few batches as 'MaxBatchSize' allows.
+// Results are returned in the same order as the references, a failure to enrich one
+// transaction doesn't affect the rest
+func (c *Client) EnrichTransactions(ctx context.Context, refs []TxRef) ([]EnrichResult, error) {
+	results := make([]EnrichResult, len(refs))
+	txs := make([]*VerboseTx, len(refs))
+	merkles := make([]*TxMerkle, len(refs))
+
+	// Use cached entries when available and queue the requests required for the rest
+	var reqs []*request
+	var targets []int
+	for i, ref := range refs {
+		richTx := new(RichTx)
+		if ok := c.loadTx(ref.Hash, richTx); ok {
+			results[i].Tx = richTx
+			continue
+		}
+
+		tx := new(VerboseTx)
+		if ok := c.loadTx(ref.Hash, tx); ok {
+			txs[i] = tx
+		} else {
+			reqs = append(reqs, c.req("blockchain.transaction.get", ref.Hash, true))
+			targets = append(targets, i)
+		}
+
+		// Transactions still in the mempool have no merkle proof yet
+		if ref.Height <= 0 {
+			continue
+		}
+		tm := new(TxMerkle)
+		if c.txCache.LoadItem(itemMerkle, merkleKey(ref.Hash, ref.Height), tm) {
+			merkles[i] = tm
+		} else {
+			reqs = append(reqs, c.req("blockchain.transaction.get_merkle", ref.Hash, strconv.Itoa(int(ref.Height))))
+			targets = append(targets, i)
+		}
+	}
+
+	res, err := c.syncBatches(ctx, reqs)
+	if err != nil {
+		return nil, err
+	}
+
+	for j, r := range res {
+		i := targets[j]
+		if results[i].Err != nil {
+			continue
+		}
+
+		var err error
+		if reqs[j].Method == "blockchain.transaction.get" {
+			txs[i] = new(VerboseTx)
+			if err = decodeObject(r, txs[i]); err == nil {
+				c.storeTx(txs[i].TxID, txs[i])
+			}
+		} else {
+			merkles[i] = new(TxMerkle)
+			if err = decodeObject(r, merkles[i]); err == nil {
+				c.storeItem(itemMerkle, merkleKey(refs[i].Hash, refs[i].Height), refs[i].Height, merkles[i])
+			}
+		}
+		if err != nil {
+			results[i].Err = fmt.Errorf("error enriching transaction %s: %w", refs[i].Hash, err)
+		}
+	}
+
+	// Resolve the outputs spent by all pending transactions together
+	var hashes []string
+	for i, tx := range txs {
+		if tx != nil && results[i].Err == nil {
+			hashes = append(hashes, prevoutHashes(tx.Vin)...)
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	parents := make(map[string]*VerboseTx, len(hashes))
+	failed := make(map[string]error)
+	for i, r := range c.fetchVerboseTransactions(ctx, hashes) {
+		if r.Err != nil {
+			failed[hashes[i]] = r.Err
+		} else {
+			parents[hashes[i]] = r.Tx
+		}
+	}
+
+	for i, tx := range txs {
+		if tx == nil || results[i].Err != nil {
+			continue
+		}
+
+		var err error
+		for _, hash := range prevoutHashes(tx.Vin) {
+			if err = failed[hash]; err != nil {
+				break
+			}
+		}
+		var vins []VinWithPrevout
+		if err == nil {
+			vins, err = linkPrevouts(tx.Vin, parents)
+		}
+		if err != nil {
+			results[i].Err = fmt.Errorf("error enriching transaction %s: %w", refs[i].Hash, err)
+			continue
+		}
+		results[i].Tx = c.buildRichTx(tx, refs[i].Height, merkles[i], vins)
+	}
+
+	return results, nil
+}
+
+// Dispatch any number of requests, split in batches of at most 'MaxBatchSize' entries sent
+// concurrently; responses are returned in the same order as the requests
+func (c *Client) syncBatches(ctx context.Context, reqs []*request) ([]*response, error) {
+	responses := make([]*response, len(reqs))
+	sem := make(chan struct{}, c.batchConcurrency)
+	errs := make(chan error, 1)
+	var wg sync.WaitGroup
+
+DISPATCH:
+	for start := 0; start < len(reqs); start += int(c.maxBatchSize) {
+		end := start + int(c.maxBatchSize)
+		if end > len(reqs) {
+			end = len(reqs)
+		}
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			break DISPATCH
+		}
+
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			res, err := c.syncBatchRequest(ctx, reqs[start:end])
+			if err != nil {
+				select {
+				case errs <- err:
+				default:
+				}
+				return
+			}
+			copy(responses[start:end], res)
+		}(start, end)
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	select {
+	case err := <-errs:
+		return nil, err
+	default:
+	}
+	return responses, nil
+}
@@ -0,0 +1,159 @@
+package electrum
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEnrichTransactions(t *testing.T) {
+	parent := strings.Repeat("a", 64)
+	children := []string{strings.Repeat("b", 64), strings.Repeat("c", 64)}
+	missing := strings.Repeat("d", 64)
+
+	var mu sync.Mutex
+	calls := map[string]int{}
+	client := newMockClient(t, nil, func(method string, params []json.RawMessage) (any, *RPCError) {
+		var hash string
+		if len(params) > 0 {
+			_ = json.Unmarshal(params[0], &hash)
+		}
+		mu.Lock()
+		calls[method+":"+hash]++
+		mu.Unlock()
+
+		if hash == missing {
+			return nil, &RPCError{Code: 2, Message: "No such mempool or blockchain transaction"}
+		}
+		if method == "blockchain.transaction.get_merkle" {
+			return &TxMerkle{BlockHeight: 100, Pos: 1}, nil
+		}
+		tx := &VerboseTx{TxID: hash, Vout: []Vout{{N: 0, Value: 0.5}, {N: 1, Value: 0.3}}}
+		if hash != parent {
+			tx.Vin = []Vin{{TxID: parent, Vout: 0}, {TxID: parent, Vout: 1}}
+			tx.Vout = []Vout{{N: 0, Value: 0.79}}
+		}
+		return tx, nil
+	})
+
+	results, err := client.EnrichTransactions(context.Background(), []TxRef{
+		{Hash: children[0], Height: 100},
+		{Hash: missing, Height: 100},
+		{Hash: children[1], Height: 100},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+
+	for _, i := range []int{0, 2} {
+		res := results[i]
+		if res.Err != nil {
+			t.Errorf("unexpected error: %v", res.Err)
+			continue
+		}
+		if res.Tx.TxID != children[i/2] || res.Tx.InputsTotal != 0.8 || res.Tx.FeeInSat != 1000000 {
+			t.Errorf("unexpected transaction: %+v", res.Tx)
+		}
+		if res.Tx.Merkle.Pos != 1 || res.Tx.Vin[1].Prevout.Value != 0.3 {
+			t.Errorf("unexpected enrichment: %+v", res.Tx)
+		}
+	}
+	if results[1].Err == nil || !strings.Contains(results[1].Err.Error(), "No such") {
+		t.Errorf("expected an error for the missing transaction, got %v", results[1].Err)
+	}
+	if n := calls["blockchain.transaction.get:"+parent]; n != 1 {
+		t.Errorf("parent requested %d times", n)
+	}
+}
+
+func TestEnrichMempoolTransactions(t *testing.T) {
+	parent, pending := strings.Repeat("a", 64), strings.Repeat("b", 64)
+
+	var mu sync.Mutex
+	var merkles int
+	client := newMockClient(t, nil, func(method string, params []json.RawMessage) (any, *RPCError) {
+		var hash string
+		if len(params) > 0 {
+			_ = json.Unmarshal(params[0], &hash)
+		}
+		if method == "blockchain.transaction.get_merkle" {
+			mu.Lock()
+			merkles++
+			mu.Unlock()
+			return nil, &RPCError{Code: 1, Message: "tx not in block"}
+		}
+		tx := &VerboseTx{TxID: hash, Vout: []Vout{{N: 0, Value: 0.5}}}
+		if hash == pending {
+			tx.Vin = []Vin{{TxID: parent, Vout: 0}}
+			tx.Vout = []Vout{{N: 0, Value: 0.49}}
+		}
+		return tx, nil
+	})
+
+	// Mempool entries are reported at height 0, or -1 when spending unconfirmed outputs
+	for _, height := range []int64{0, -1} {
+		results, err := client.EnrichTransactions(context.Background(), []TxRef{{Hash: pending, Height: height}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res := results[0]; res.Err != nil || res.Tx.FeeInSat != 1000000 || res.Tx.Merkle.Merkle != nil {
+			t.Errorf("unexpected result at height %d: %+v, %v", height, res.Tx, res.Err)
+		}
+	}
+	tx, err := client.GetVerboseTransaction(pending)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rich, err := client.EnrichTransaction(tx, 0); err != nil || rich.FeeInSat != 1000000 {
+		t.Errorf("unexpected result: %+v, %v", rich, err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if merkles != 0 {
+		t.Errorf("expected no merkle requests for unconfirmed transactions, got %d", merkles)
+	}
+}
+
+func TestEnrichTransactionsCanceled(t *testing.T) {
+	parent, child := strings.Repeat("a", 64), strings.Repeat("b", 64)
+	requested := make(chan struct{}, 1)
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	client := newMockClient(t, nil, func(method string, params []json.RawMessage) (any, *RPCError) {
+		var hash string
+		if len(params) > 0 {
+			_ = json.Unmarshal(params[0], &hash)
+		}
+		switch {
+		case method == "blockchain.transaction.get_merkle":
+			return &TxMerkle{BlockHeight: 100, Pos: 1}, nil
+		case hash == parent:
+			requested <- struct{}{}
+			<-release
+		}
+		return &VerboseTx{TxID: hash, Vin: []Vin{{TxID: parent, Vout: 0}}, Vout: []Vout{{N: 0, Value: 0.1}}}, nil
+	})
+
+	// Outputs spent are resolved within the context as well
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-requested
+		cancel()
+	}()
+	start := time.Now()
+	results, err := client.EnrichTransactions(ctx, []TxRef{{Hash: child, Height: 100}})
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("enrichment took %s", elapsed)
+	}
+	if err == nil && !errors.Is(results[0].Err, context.Canceled) {
+		t.Errorf("expected the enrichment to be canceled, got %+v", results[0])
+	}
+}
@@ -0,0 +1,36 @@
+package electrum
+
+// Error codes used by the servers
+//
+// https://github.com/spesmilo/electrumx/blob/master/src/electrumx/server/session.py
+const (
+	codeBadRequest             = 1
+	codeDaemonError            = 2
+	codeExcessiveResourceUsage = -101
+	codeServerBusy             = -102
+	codeInvalidRequest         = -32600
+	codeMethodNotFound         = -32601
+	codeInvalidParams          = -32602
+)
+
+// Error returns the message reported by the server
+func (e *RPCError) Error() string {
+	return e.Message
+}
+
+// Is matches the error against the sentinel of its code
+func (e *RPCError) Is(target error) bool {
+	switch target {
+	case ErrBadRequest:
+		return e.Code == codeBadRequest || e.Code == codeInvalidRequest || e.Code == codeInvalidParams
+	case ErrDaemonError:
+		return e.Code == codeDaemonError
+	case ErrExcessiveResourceUsage:
+		return e.Code == codeExcessiveResourceUsage
+	case ErrServerBusy:
+		return e.Code == codeServerBusy
+	case ErrUnavailableMethod:
+		return e.Code == codeMethodNotFound
+	}
+	return false
+}
@@ -0,0 +1,35 @@
+package electrum
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestRPCError(t *testing.T) {
+	client := newMockClient(t, nil, func(method string, params []json.RawMessage) (any, *RPCError) {
+		switch method {
+		case "blockchain.scripthash.get_balance":
+			return nil, &RPCError{Code: -101, Message: "excessive resource usage", Data: map[string]any{"cost": 10}}
+		case "blockchain.scripthash.get_history":
+			return nil, &RPCError{Code: 2, Message: "daemon error"}
+		}
+		return nil, &RPCError{Code: -32601, Message: "unknown method"}
+	})
+
+	_, err := client.ScriptHashBalance("a")
+	if !errors.Is(err, ErrExcessiveResourceUsage) || errors.Is(err, ErrDaemonError) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Code != -101 || rpcErr.Data.(map[string]any)["cost"] != 10.0 {
+		t.Errorf("error details not preserved: %#v", rpcErr)
+	}
+
+	if _, err := client.ScriptHashHistory("a"); !errors.Is(err, ErrDaemonError) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := client.ScriptHashMempool("a"); !errors.Is(err, ErrUnavailableMethod) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,189 @@
+package electrum
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+const (
+	// Satoshis in a BTC/kB rate expressed in sat/vB
+	satPerVBPerBTCPerKB = 1e8 / 1000
+
+	// Virtual size of a full block, used to estimate how many blocks the mempool spans
+	blockVSize = 1_000_000
+
+	// Rate used as floor when the server doesn't report its relay fee
+	defaultRelayFee = 1.0
+)
+
+// FeeBucket groups the mempool transactions paying at least a given fee rate
+type FeeBucket struct {
+	// Fee rate in sat/vB
+	FeeRate float64
+
+	// Total virtual size of the transactions paying this fee rate, up to the previous bucket
+	VSize uint64
+}
+
+// UnmarshalJSON decodes the '[fee_rate, vsize]' pairs reported by the server
+func (b *FeeBucket) UnmarshalJSON(data []byte) error {
+	var pair []float64
+	if err := json.Unmarshal(data, &pair); err != nil {
+		return err
+	}
+	if len(pair) != 2 || pair[0] < 0 || pair[1] < 0 {
+		return fmt.Errorf("invalid fee histogram entry: %s", data)
+	}
+	b.FeeRate = pair[0]
+	b.VSize = uint64(pair[1])
+	return nil
+}
+
+// FeeHistogram will synchronously run a 'mempool.get_fee_histogram' operation. Buckets
+// are sorted by decreasing fee rate
+//
+// https://electrumx.readthedocs.io/en/latest/protocol-methods.html#mempool-get-fee-histogram
+func (c *Client) FeeHistogram() ([]FeeBucket, error) {
+	res, err := c.syncRequest(c.req("mempool.get_fee_histogram"))
+	if err != nil {
+		return nil, err
+	}
+
+	var list []FeeBucket
+	if err := decodeResult(res, &list); err != nil {
+		return nil, err
+	}
+	sortBuckets(list)
+	return list, nil
+}
+
+// RelayFee will synchronously run a 'blockchain.relayfee' operation, returning the
+// minimum fee rate accepted by the server in sat/vB
+//
+// https://electrumx.readthedocs.io/en/latest/protocol-methods.html#blockchain-relayfee
+func (c *Client) RelayFee() (float64, error) {
+	res, err := c.syncRequest(c.req("blockchain.relayfee"))
+	if err != nil {
+		return 0, err
+	}
+
+	var fee float64
+	if err := decodeResult(res, &fee); err != nil {
+		return 0, err
+	}
+	return fee * satPerVBPerBTCPerKB, nil
+}
+
+// FeeRates suggested by a FeeEstimator, in sat/vB
+type FeeRates struct {
+	Economy  float64
+	Normal   float64
+	Priority float64
+
+	// Minimum rate accepted by the server, no suggestion is lower
+	RelayFee float64
+}
+
+// FeeEstimator suggests fee rates combining the server estimates for a set of confirmation
+// targets with the current state of the mempool
+type FeeEstimator struct {
+	c *Client
+
+	// Confirmation targets, in blocks, of each suggested rate
+	EconomyTarget  int
+	NormalTarget   int
+	PriorityTarget int
+}
+
+// NewFeeEstimator returns an estimator targeting confirmation in 144, 6 and 2 blocks
+// for the economy, normal and priority rates respectively
+func (c *Client) NewFeeEstimator() *FeeEstimator {
+	return &FeeEstimator{
+		c:              c,
+		EconomyTarget:  144,
+		NormalTarget:   6,
+		PriorityTarget: 2,
+	}
+}
+
+// Estimate suggests fee rates, all requests are sent in a single batch. The server
+// estimate for a target is checked against the rate required to be included within as
+// many blocks according to the mempool histogram: the priority rate takes the highest
+// of both, the economy rate the lowest. When the server is unable to estimate a target
+// the histogram is used alone, rates are never lower than the relay fee
+func (e *FeeEstimator) Estimate(ctx context.Context) (*FeeRates, error) {
+	batch := e.c.NewBatch()
+	relay := Queue[float64](batch, "blockchain.relayfee")
+	histogram := Queue[[]FeeBucket](batch, "mempool.get_fee_histogram")
+	targets := []int{e.EconomyTarget, e.NormalTarget, e.PriorityTarget}
+	estimates := make([]*Future[float64], len(targets))
+	for i, blocks := range targets {
+		estimates[i] = Queue[float64](batch, "blockchain.estimatefee", blocks)
+	}
+	if err := batch.Send(WithPriority(ctx, priorityOf(ctx, PriorityNormal))); err != nil {
+		return nil, fmt.Errorf("error estimating fees: %w", err)
+	}
+
+	rates := &FeeRates{RelayFee: defaultRelayFee}
+	if fee, err := relay.Result(); err == nil && fee > 0 {
+		rates.RelayFee = fee * satPerVBPerBTCPerKB
+	}
+	buckets, histErr := histogram.Result()
+	sortBuckets(buckets)
+
+	var suggested [3]float64
+	var available bool
+	for i, blocks := range targets {
+		estimate, err := estimates[i].Result()
+		known := err == nil && estimate > 0
+		if err != nil && histErr != nil {
+			return nil, fmt.Errorf("error estimating fees for %d blocks: %w", blocks, err)
+		}
+		estimate *= satPerVBPerBTCPerKB
+
+		mempool := mempoolFeeRate(buckets, blocks)
+		switch {
+		case !known:
+			suggested[i] = mempool
+		case histErr != nil:
+			suggested[i] = estimate
+		case i == 0:
+			suggested[i] = min(estimate, mempool)
+		case i == 2:
+			suggested[i] = max(estimate, mempool)
+		default:
+			suggested[i] = estimate
+		}
+		available = available || known || histErr == nil
+	}
+	if !available {
+		return nil, fmt.Errorf("error estimating fees: %w", ErrNoFeeEstimate)
+	}
+
+	// Faster targets never suggest lower rates
+	rates.Priority = max(suggested[2], rates.RelayFee)
+	rates.Normal = min(max(suggested[1], rates.RelayFee), rates.Priority)
+	rates.Economy = min(max(suggested[0], rates.RelayFee), rates.Normal)
+	return rates, nil
+}
+
+// Lowest fee rate of the transactions fitting in the given number of blocks, starting
+// from the highest paying ones; zero if the whole mempool fits
+func mempoolFeeRate(buckets []FeeBucket, blocks int) float64 {
+	var vsize uint64
+	for _, b := range buckets {
+		vsize += b.VSize
+		if vsize >= uint64(blocks)*blockVSize {
+			return b.FeeRate
+		}
+	}
+	return 0
+}
+
+func sortBuckets(buckets []FeeBucket) {
+	sort.SliceStable(buckets, func(i, j int) bool {
+		return buckets[i].FeeRate > buckets[j].FeeRate
+	})
+}
@@ -0,0 +1,71 @@
+package electrum
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestFeeEstimator(t *testing.T) {
+	estimates := map[int]float64{144: 0.00002, 6: 0.0001, 2: -1}
+	histogram := [][2]float64{{5, 200_000}, {50, 600_000}, {20, 1_500_000}, {2, 5_000_000}}
+	var mu sync.Mutex
+	client := newMockClient(t, nil, func(method string, params []json.RawMessage) (any, *RPCError) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch method {
+		case "blockchain.relayfee":
+			return 0.00001, nil
+		case "mempool.get_fee_histogram":
+			return histogram, nil
+		case "blockchain.estimatefee":
+			var blocks int
+			if err := json.Unmarshal(params[0], &blocks); err != nil {
+				return nil, &RPCError{Code: 1, Message: "blocks must be an integer"}
+			}
+			return estimates[blocks], nil
+		}
+		return nil, &RPCError{Code: -32601, Message: "unknown method"}
+	})
+
+	buckets, err := client.FeeHistogram()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buckets) != 4 || buckets[0].FeeRate != 50 || buckets[3].VSize != 5_000_000 {
+		t.Errorf("unexpected histogram: %+v", buckets)
+	}
+	relay, err := client.RelayFee()
+	if err != nil || relay != 1 {
+		t.Errorf("unexpected relay fee: %v, %v", relay, err)
+	}
+	if _, err := client.EstimateFee(2); !errors.Is(err, ErrNoFeeEstimate) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	rates, err := client.NewFeeEstimator().Estimate(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Priority: no estimate, 2 blocks reach into the 20 sat/vB bucket
+	// Normal: server estimate of 10 sat/vB
+	// Economy: the whole mempool fits in 144 blocks, floored at the relay fee
+	expected := FeeRates{Economy: 1, Normal: 10, Priority: 20, RelayFee: 1}
+	if *rates != expected {
+		t.Errorf("expected %+v, got %+v", expected, *rates)
+	}
+
+	mu.Lock()
+	histogram = nil
+	estimates = map[int]float64{144: -1, 6: -1, 2: -1}
+	mu.Unlock()
+	rates, err = client.NewFeeEstimator().Estimate(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rates.Economy != 1 || rates.Priority != 1 {
+		t.Errorf("expected relay fee floor, got %+v", *rates)
+	}
+}
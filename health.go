@@ -0,0 +1,284 @@
+package electrum
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// Weight of new samples in the latency and error rate moving averages
+	healthSmoothing = 0.2
+
+	// Blocks a server may lag behind others before being deprioritized, as servers
+	// learn about new blocks at slightly different times
+	tipLagTolerance = 1
+)
+
+// Health is a snapshot of the state of the connection with the server
+type Health struct {
+	Address string
+
+	// Moving average of the round-trip time of requests and pings respectively; batches
+	// count as a single request
+	Latency     time.Duration
+	PingLatency time.Duration
+
+	// Requests sent, those left without a response due to network failures or timeouts,
+	// and those reporting server side errors, i.e. daemon errors or excessive load
+	Requests     uint64
+	Failures     uint64
+	ServerErrors uint64
+
+	// Moving average of the share of requests either failing or reporting server side
+	// errors, from 0 to 1
+	ErrorRate float64
+
+	// Latest chain tip reported by the server, and the number of blocks it lags behind
+	// the median tip of the servers in its pool; always zero outside a pool
+	TipHeight int64
+	TipLag    int64
+
+	// Overall health, from 0 to 1, used to rank servers; latency, errors and tip lag
+	// beyond a block all lower it
+	Score float64
+}
+
+// Connection statistics collected as requests are processed
+type healthStats struct {
+	mu           sync.Mutex
+	latency      time.Duration
+	pingLatency  time.Duration
+	requests     uint64
+	failures     uint64
+	serverErrors uint64
+	errorRate    float64
+	tip          int64
+}
+
+// Record the outcome of a request: the time taken to receive its response and the error
+// reported, if any. Errors caused by the request itself, or a canceled context, aren't the
+// server's fault and count as successful
+func (h *healthStats) request(rtt time.Duration, err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	var rpcErr *RPCError
+	responded := errors.As(err, &rpcErr)
+	if responded && !serverError(rpcErr) {
+		err = nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.requests++
+	switch {
+	case err == nil:
+		h.errorRate -= healthSmoothing * h.errorRate
+	case responded:
+		h.serverErrors++
+		h.errorRate += healthSmoothing * (1 - h.errorRate)
+	default:
+		h.failures++
+		h.errorRate += healthSmoothing * (1 - h.errorRate)
+	}
+	if err == nil || responded {
+		h.latency = smooth(h.latency, rtt)
+	}
+}
+
+// Error reported by a response, nil if successful
+func responseError(resp *response) error {
+	if resp == nil {
+		return ErrMissingResponse
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	return nil
+}
+
+// Reports whether a response error is caused by the server rather than the request
+func serverError(err *RPCError) bool {
+	return err != nil && (errors.Is(err, ErrDaemonError) ||
+		errors.Is(err, ErrExcessiveResourceUsage) ||
+		errors.Is(err, ErrServerBusy))
+}
+
+func (h *healthStats) ping(rtt time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.pingLatency = smooth(h.pingLatency, rtt)
+}
+
+// Record the chain tip reported by the server
+func (h *healthStats) observeTip(height int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.tip = height
+}
+
+// Update a moving average with a new sample, starting from the first one
+func smooth(avg, sample time.Duration) time.Duration {
+	if avg == 0 {
+		return sample
+	}
+	return avg + time.Duration(healthSmoothing*float64(sample-avg))
+}
+
+// Health returns a snapshot of the state of the connection with the server. It doesn't
+// send any request, the tip is the latest one observed, see 'Pool.Refresh' to update it
+func (c *Client) Health() *Health {
+	h := &c.health
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	health := &Health{
+		Address:      c.Address,
+		Latency:      h.latency,
+		PingLatency:  h.pingLatency,
+		Requests:     h.requests,
+		Failures:     h.failures,
+		ServerErrors: h.serverErrors,
+		ErrorRate:    h.errorRate,
+		TipHeight:    h.tip,
+	}
+	health.score()
+	return health
+}
+
+// Compute the health score from the other statistics
+func (h *Health) score() {
+	h.Score = (1 - h.ErrorRate) / (1 + max(h.Latency, h.PingLatency).Seconds())
+	if lag := h.TipLag - tipLagTolerance; lag > 0 {
+		h.Score /= float64(1 + lag)
+	}
+}
+
+// Pool ranks clients connected to different servers by health; servers lagging behind
+// the others, slow or failing are deprioritized. Use 'Refresh' periodically to keep the
+// latency and chain tips of idle servers current
+type Pool struct {
+	mu      sync.Mutex
+	clients []*Client
+}
+
+// NewPool returns a pool of the given clients
+func NewPool(clients ...*Client) *Pool {
+	return &Pool{clients: clients}
+}
+
+// Add a client to the pool
+func (p *Pool) Add(c *Client) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clients = append(p.clients, c)
+}
+
+// Remove a client from the pool, it isn't closed
+func (p *Pool) Remove(c *Client) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, other := range p.clients {
+		if other == c {
+			p.clients = append(p.clients[:i], p.clients[i+1:]...)
+			return
+		}
+	}
+}
+
+// Refresh pings every server and retrieves its chain tip. Servers not responding before
+// the context is done, or the client timeout, are left as they are
+func (p *Pool) Refresh(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, c := range p.members() {
+		wg.Add(1)
+		go func(c *Client) {
+			defer wg.Done()
+			if err := c.serverPing(ctx); err != nil {
+				c.debug("health check ping failed: %v", err)
+			}
+			if _, err := c.tipHeightContext(ctx); err != nil {
+				c.debug("health check tip refresh failed: %v", err)
+			}
+		}(c)
+	}
+	wg.Wait()
+}
+
+// Health returns the health of every client, best first
+func (p *Pool) Health() []*Health {
+	_, health := p.rank()
+	return health
+}
+
+// Client returns the healthiest client, ErrUnreachableHost if the pool is empty
+func (p *Pool) Client() (*Client, error) {
+	ranked, _ := p.rank()
+	if len(ranked) == 0 {
+		return nil, ErrUnreachableHost
+	}
+	return ranked[0], nil
+}
+
+// Clients returns all clients, best first
+func (p *Pool) Clients() []*Client {
+	ranked, _ := p.rank()
+	return ranked
+}
+
+func (p *Pool) members() []*Client {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*Client(nil), p.clients...)
+}
+
+// Sort the clients by decreasing health score, measuring the tip lag of each one against
+// the median of the current tips, so a single server reporting a bogus height can't mark
+// the others as lagging
+func (p *Pool) rank() ([]*Client, []*Health) {
+	clients := p.members()
+	health := make([]*Health, len(clients))
+	for i, c := range clients {
+		health[i] = c.Health()
+	}
+	median := medianTip(health)
+	for _, h := range health {
+		if h.TipHeight > 0 && h.TipHeight < median {
+			h.TipLag = median - h.TipHeight
+			h.score()
+		}
+	}
+	order := make([]int, len(clients))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return health[order[i]].Score > health[order[j]].Score
+	})
+
+	rankedClients := make([]*Client, len(clients))
+	rankedHealth := make([]*Health, len(clients))
+	for i, j := range order {
+		rankedClients[i] = clients[j]
+		rankedHealth[i] = health[j]
+	}
+	return rankedClients, rankedHealth
+}
+
+// Median of the chain tips known, zero if none is
+func medianTip(health []*Health) int64 {
+	var tips []int64
+	for _, h := range health {
+		if h.TipHeight > 0 {
+			tips = append(tips, h.TipHeight)
+		}
+	}
+	if len(tips) == 0 {
+		return 0
+	}
+	sort.Slice(tips, func(i, j int) bool { return tips[i] < tips[j] })
+	return tips[len(tips)/2]
+}
@@ -0,0 +1,106 @@
+package electrum
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHealth(t *testing.T) {
+	server := func(tip int64, pingErr *RPCError) *Client {
+		return newMockClient(t, nil, func(method string, params []json.RawMessage) (any, *RPCError) {
+			switch method {
+			case "server.ping":
+				return nil, pingErr
+			case "blockchain.headers.subscribe":
+				return &BlockHeader{Height: tip, Hex: hex.EncodeToString(make([]byte, 80))}, nil
+			}
+			return nil, &RPCError{Code: -32601, Message: "unknown method"}
+		})
+	}
+	current := server(100, nil)
+	lagging := server(95, nil)
+	busy := server(100, &RPCError{Code: -102, Message: "server busy"})
+	bogus := server(1_000_000, nil)
+	hung := newMockClient(t, nil, func(method string, params []json.RawMessage) (any, *RPCError) {
+		return mockSkip, nil
+	})
+
+	// A member not responding holds the refresh only until the context is done
+	pool := NewPool(lagging, busy, current, bogus, hung)
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	pool.Refresh(ctx)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("refresh took %s", elapsed)
+	}
+	if h := hung.Health(); h.TipHeight != 0 || h.TipLag != 0 {
+		t.Errorf("unexpected health: %+v", h)
+	}
+	pool.Remove(hung)
+
+	// Lag is measured against the median tip, a bogus height doesn't affect the others
+	if h := current.Health(); h.TipLag != 0 {
+		t.Errorf("expected no lag outside the pool: %+v", h)
+	}
+	ranked := pool.Health()
+	if ranked[len(ranked)-1].Address != lagging.Address || ranked[len(ranked)-1].TipLag != 5 {
+		t.Errorf("expected the lagging server last: %+v", ranked[len(ranked)-1])
+	}
+	for _, h := range ranked[:len(ranked)-1] {
+		if h.TipLag != 0 {
+			t.Errorf("unexpected tip lag: %+v", h)
+		}
+	}
+	pool.Remove(bogus)
+
+	h := current.Health()
+	if h.Requests != 2 || h.Failures != 0 || h.ErrorRate != 0 || h.TipHeight != 100 {
+		t.Errorf("unexpected health: %+v", h)
+	}
+	if h.Latency <= 0 || h.PingLatency <= 0 {
+		t.Errorf("expected latency to be measured: %+v", h)
+	}
+
+	// Requests rejected by the server aren't its fault
+	if _, err := current.ServerBanner(); !errors.Is(err, ErrUnavailableMethod) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if h := current.Health(); h.Requests != 3 || h.ErrorRate != 0 {
+		t.Errorf("unexpected health: %+v", h)
+	}
+
+	h = busy.Health()
+	if h.ServerErrors != 1 || h.ErrorRate == 0 || h.PingLatency != 0 {
+		t.Errorf("unexpected health: %+v", h)
+	}
+
+	ranked = pool.Health()
+	if ranked[0].Address != current.Address || ranked[2].Address != lagging.Address {
+		t.Errorf("unexpected ranking: %+v, %+v, %+v", ranked[0], ranked[1], ranked[2])
+	}
+	if ranked[2].TipLag != 5 || ranked[0].TipLag != 0 {
+		t.Errorf("unexpected tip lag: %d, %d", ranked[2].TipLag, ranked[0].TipLag)
+	}
+	if best, err := pool.Client(); err != nil || best != current {
+		t.Errorf("unexpected best client: %v, %v", best, err)
+	}
+
+	// Lag isn't retained once the others fall back to the same height after a reorg
+	pool.Remove(busy)
+	current.health.observeTip(95)
+	if ranked := pool.Health(); ranked[0].TipLag != 0 || ranked[1].TipLag != 0 {
+		t.Errorf("unexpected tip lag after reorg: %d, %d", ranked[0].TipLag, ranked[1].TipLag)
+	}
+	pool.Add(busy)
+	current.health.observeTip(100)
+
+	pool.Remove(current)
+	if best, _ := pool.Client(); best != busy {
+		t.Errorf("expected the busy server to be preferred over the lagging one")
+	}
+}
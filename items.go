@@ -0,0 +1,170 @@
+package electrum
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+)
+
+// Kinds of auxiliary cache entries
+const (
+	itemMerkle     = "merkle"
+	itemHeader     = "header"
+	itemCheckpoint = "checkpoint"
+	itemHistory    = "history"
+	itemTxPos      = "txpos"
+)
+
+// Cached scripthash history, valid while the server reports the same status
+type cachedHistory struct {
+	Status  string `json:"status"`
+	History []Tx   `json:"history"`
+}
+
+// Reports whether the block at the given height is buried deep enough in the chain for the
+// values depending on it to be cached
+func (c *Client) buried(height int64) bool {
+	if c.txCache == NoCache || height <= 0 {
+		return false
+	}
+	tip, err := c.tipHeight()
+	if err != nil {
+		c.error("refreshing chain tip failed: %v", err)
+		return false
+	}
+	return tip-height+1 >= int64(c.cacheDepth)
+}
+
+// Store an auxiliary value in the cache once the block it depends on is buried deep enough
+func (c *Client) storeItem(kind, key string, height int64, item any) {
+	if !c.buried(height) {
+		return
+	}
+	if err := c.txCache.StoreItem(kind, key, height, item); err != nil {
+		c.error("Store %s %s in cache failed: %v", kind, key, err)
+	}
+}
+
+func merkleKey(txID string, height int64) string {
+	return txID + ":" + strconv.FormatInt(height, 10)
+}
+
+// RawBlockHeader returns the serialized header of the block at the given height. Headers
+// buried deep enough in the chain are cached, both by height and hash
+//
+// https://electrumx.readthedocs.io/en/latest/protocol-methods.html#blockchain-block-header
+func (c *Client) RawBlockHeader(height int64) (string, error) {
+	key := strconv.FormatInt(height, 10)
+	var header string
+	if c.txCache.LoadItem(itemHeader, key, &header) {
+		return header, nil
+	}
+
+	res, err := c.syncRequest(c.req("blockchain.block.header", height))
+	if err != nil {
+		return "", fmt.Errorf("error getting block header %d: %w", height, err)
+	}
+	if err := decodeResult(res, &header); err != nil {
+		return "", fmt.Errorf("error getting block header %d: %w", height, err)
+	}
+
+	if c.buried(height) {
+		hash, err := headerHash(header)
+		if err != nil {
+			return "", fmt.Errorf("error getting block header %d: %w", height, err)
+		}
+		c.storeItem(itemHeader, key, height, header)
+		c.storeItem(itemHeader, hash, height, header)
+	}
+	return header, nil
+}
+
+// CachedBlockHeader returns the serialized header of a block by hash; the protocol doesn't
+// support such lookups, so only headers previously retrieved with 'RawBlockHeader' and
+// cached are available
+func (c *Client) CachedBlockHeader(hash string) (string, bool) {
+	var header string
+	ok := c.txCache.LoadItem(itemHeader, hash, &header)
+	return header, ok
+}
+
+// Scripthash history reused from the cache while its status matches the one reported by
+// the server. Histories including unconfirmed transactions are cached as well, the status
+// changes as soon as any of them confirms
+func (c *Client) cachedScriptHashHistory(ctx context.Context, scriptHash string) ([]Tx, error) {
+	status, err := c.scriptHashStatus(ctx, scriptHash)
+	if err != nil {
+		return nil, fmt.Errorf("error getting history for scripthash %s: %w", scriptHash, err)
+	}
+
+	if list, ok := c.loadHistory(scriptHash, status); ok {
+		return list, nil
+	}
+
+	list, err := c.scriptHashHistory(ctx, scriptHash)
+	if err != nil {
+		return nil, err
+	}
+	c.storeHistory(scriptHash, status, list)
+	return list, nil
+}
+
+// Load a cached history, only valid while matching the current status
+func (c *Client) loadHistory(scriptHash, status string) ([]Tx, bool) {
+	cached := new(cachedHistory)
+	if c.txCache.LoadItem(itemHistory, scriptHash, cached) && cached.Status == status {
+		return cached.History, true
+	}
+	return nil, false
+}
+
+// Store a history along with its status. The history may have changed since the status
+// was retrieved, it's only cached when both are consistent
+func (c *Client) storeHistory(scriptHash, status string, list []Tx) {
+	if historyStatus(list) != status {
+		return
+	}
+
+	var height int64
+	for _, tx := range list {
+		if tx.Height > height {
+			height = tx.Height
+		}
+	}
+	if err := c.txCache.StoreItem(itemHistory, scriptHash, height, &cachedHistory{Status: status, History: list}); err != nil {
+		c.error("Store history %s in cache failed: %v", scriptHash, err)
+	}
+}
+
+// Current status of a scripthash, empty if it has no history
+//
+// https://electrumx.readthedocs.io/en/latest/protocol-methods.html#blockchain-scripthash-subscribe
+func (c *Client) scriptHashStatus(ctx context.Context, scriptHash string) (string, error) {
+	res, err := c.syncRequestContext(ctx, c.req("blockchain.scripthash.subscribe", scriptHash))
+	if err != nil {
+		return "", err
+	}
+
+	var status *string
+	if err := decodeResult(res, &status); err != nil || status == nil {
+		return "", err
+	}
+	return *status, nil
+}
+
+// Status of a history as defined by the protocol: the hex encoded SHA256 of the
+// concatenated 'tx_hash:height:' entries, empty for no history
+//
+// https://electrumx.readthedocs.io/en/latest/protocol-basics.html#status
+func historyStatus(history []Tx) string {
+	if len(history) == 0 {
+		return ""
+	}
+	h := sha256.New()
+	for _, tx := range history {
+		fmt.Fprintf(h, "%s:%d:", tx.Hash, tx.Height)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,128 @@
+package electrum
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestHistoryStatus(t *testing.T) {
+	if status := historyStatus(nil); status != "" {
+		t.Errorf("unexpected status for an empty history: %s", status)
+	}
+
+	history := []Tx{{Hash: "aa", Height: 1}, {Hash: "bb", Height: 0}}
+	if status := historyStatus(history); status != "6c5d8147ca17d224e79a56736bf5bb420480364f6af1dd6d497efb4423d67a4a" {
+		t.Errorf("unexpected status: %s", status)
+	}
+}
+
+func TestCachedItems(t *testing.T) {
+	chain := &mockChain{tip: 100}
+	txID := strings.Repeat("a", 64)
+	scriptHash := strings.Repeat("b", 64)
+	history := []Tx{{Hash: txID, Height: 90}}
+
+	var mu sync.Mutex
+	calls := map[string]int{}
+	client := newMockClient(t, &Options{CacheHistories: true}, func(method string, params []json.RawMessage) (any, *RPCError) {
+		mu.Lock()
+		calls[method]++
+		mu.Unlock()
+
+		chain.Lock()
+		defer chain.Unlock()
+		switch method {
+		case "blockchain.headers.subscribe":
+			return &BlockHeader{Height: chain.tip, Hex: chain.header(chain.tip)}, nil
+		case "blockchain.block.header":
+			var height int64
+			_ = json.Unmarshal(params[0], &height)
+			return chain.header(height), nil
+		case "blockchain.transaction.get_merkle":
+			return &TxMerkle{BlockHeight: 90, Pos: 2}, nil
+		case "blockchain.scripthash.subscribe":
+			return historyStatus(history), nil
+		case "blockchain.scripthash.get_history":
+			return history, nil
+		}
+		return nil, &RPCError{Message: "unknown method"}
+	})
+
+	count := func(method string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls[method]
+	}
+
+	t.Run("Merkle", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			tm, err := client.TransactionMerkle(txID, 90)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tm.Pos != 2 {
+				t.Errorf("unexpected proof: %+v", tm)
+			}
+		}
+		if n := count("blockchain.transaction.get_merkle"); n != 1 {
+			t.Errorf("expected 1 request, got %d", n)
+		}
+
+		// Proofs for blocks not buried deep enough aren't cached
+		for i := 0; i < 2; i++ {
+			if _, err := client.TransactionMerkle(txID, 99); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if n := count("blockchain.transaction.get_merkle"); n != 3 {
+			t.Errorf("expected 3 requests, got %d", n)
+		}
+	})
+
+	t.Run("Header", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			header, err := client.RawBlockHeader(50)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if header != chain.header(50) {
+				t.Errorf("unexpected header: %s", header)
+			}
+		}
+		if n := count("blockchain.block.header"); n != 1 {
+			t.Errorf("expected 1 request, got %d", n)
+		}
+		if header, ok := client.CachedBlockHeader(chain.hash(50)); !ok || header != chain.header(50) {
+			t.Errorf("header not cached by hash: %s", header)
+		}
+	})
+
+	t.Run("History", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			list, err := client.ScriptHashHistory(scriptHash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(list) != 1 || list[0].Hash != txID {
+				t.Errorf("unexpected history: %+v", list)
+			}
+		}
+		if n := count("blockchain.scripthash.get_history"); n != 1 {
+			t.Errorf("expected 1 request, got %d", n)
+		}
+
+		// A new transaction changes the status, invalidating the cached history
+		chain.Lock()
+		history = append(history, Tx{Hash: strings.Repeat("c", 64)})
+		chain.Unlock()
+		list, err := client.ScriptHashHistory(scriptHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list) != 2 || count("blockchain.scripthash.get_history") != 2 {
+			t.Errorf("expected the history to be refreshed: %+v", list)
+		}
+	})
+}
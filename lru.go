@@ -0,0 +1,181 @@
+package electrum
+
+import (
+	"container/list"
+	"encoding/json"
+	"sync"
+)
+
+// Number of entries kept by a MemoryCache when no size is provided
+const defaultMemoryCacheSize = 10000
+
+// MemoryCache is a bounded in-memory Cache, evicting the least recently used entries once
+// full; useful for short-lived processes, read-only environments or tests
+type MemoryCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type memoryEntry struct {
+	key      string
+	data     []byte
+	detailed bool
+	height   int64
+}
+
+// NewMemoryCache returns a cache holding up to 'size' transactions
+func NewMemoryCache(size int) *MemoryCache {
+	if size <= 0 {
+		size = defaultMemoryCacheSize
+	}
+	return &MemoryCache{
+		size:    size,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// Store the transaction, detailed entries are never replaced by verbose ones
+func (c *MemoryCache) Store(txID string, tx any) error {
+	b, err := json.Marshal(tx)
+	if err != nil {
+		return err
+	}
+	_, height := txBlock(tx)
+	c.put(txID, b, isRichTx(tx), height)
+	return nil
+}
+
+// StoreMany stores the transactions, as successive calls to 'Store' would
+func (c *MemoryCache) StoreMany(txs map[string]any) error {
+	for txID, tx := range txs {
+		if err := c.Store(txID, tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadMany loads the verbose details of the transactions found in the cache
+func (c *MemoryCache) LoadMany(txIDs []string) map[string]*VerboseTx {
+	txs := make(map[string]*VerboseTx, len(txIDs))
+	for _, txID := range txIDs {
+		tx := new(VerboseTx)
+		if c.Load(txID, tx) {
+			txs[txID] = tx
+		}
+	}
+	return txs
+}
+
+// StoreItem stores an auxiliary value, sharing the capacity with the transactions
+func (c *MemoryCache) StoreItem(kind, key string, height int64, item any) error {
+	b, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	c.put(itemKey(kind, key), b, false, height)
+	return nil
+}
+
+// LoadItem loads an auxiliary value into the provided value
+func (c *MemoryCache) LoadItem(kind, key string, item any) bool {
+	entry, ok := c.get(itemKey(kind, key))
+	return ok && json.Unmarshal(entry.data, item) == nil
+}
+
+// Insert or update an entry; detailed entries are never replaced by non-detailed ones
+func (c *MemoryCache) put(key string, data []byte, detailed bool, height int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.order.MoveToFront(el)
+		entry := el.Value.(*memoryEntry)
+		if !entry.detailed {
+			entry.data, entry.detailed, entry.height = data, detailed, height
+		}
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&memoryEntry{key: key, data: data, detailed: detailed, height: height})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*memoryEntry).key)
+	}
+}
+
+// Copy of an entry, marked as the most recently used
+func (c *MemoryCache) get(key string) (memoryEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return memoryEntry{}, false
+	}
+	c.order.MoveToFront(el)
+	return *el.Value.(*memoryEntry), true
+}
+
+// Auxiliary entries share the key space with transactions, which never contain a colon
+func itemKey(kind, key string) string {
+	return kind + ":" + key
+}
+
+// Load a transaction into the provided value
+func (c *MemoryCache) Load(txID string, tx any) bool {
+	entry, ok := c.get(txID)
+	if !ok {
+		return false
+	}
+	if _, ok := tx.(*RichTx); ok && !entry.detailed {
+		return false
+	}
+	return json.Unmarshal(entry.data, tx) == nil
+}
+
+// Remove deletes a transaction, if cached
+func (c *MemoryCache) Remove(txID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[txID]; ok {
+		c.order.Remove(el)
+		delete(c.entries, txID)
+	}
+	return nil
+}
+
+// PurgeAbove removes the entries included in blocks above the given height
+func (c *MemoryCache) PurgeAbove(height int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, el := range c.entries {
+		if el.Value.(*memoryEntry).height > height {
+			c.order.Remove(el)
+			delete(c.entries, key)
+		}
+	}
+	return nil
+}
+
+// Len returns the number of cached entries
+func (c *MemoryCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// Close drops all cached entries
+func (c *MemoryCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]*list.Element)
+	c.order.Init()
+	return nil
+}
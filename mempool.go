@@ -0,0 +1,228 @@
+package electrum
+
+// Any input with a sequence number below this value explicitly signals opt-in replaceability
+// https://github.com/bitcoin/bips/blob/master/bip-0125.mediawiki
+const rbfSequenceThreshold = 0xfffffffe
+
+// Ancestor describes an unconfirmed transaction a pending transaction depends on
+type Ancestor struct {
+	TxID       string `json:"txid"`
+	Fee        int64  `json:"fee"`
+	VSize      uint32 `json:"vsize"`
+	SignalsRBF bool   `json:"signals_rbf"`
+}
+
+// BumpInfo summarizes the fee bumping options available for a pending transaction;
+// fees are expressed in satoshis and fee rates in sat/vB
+type BumpInfo struct {
+	TxID      string `json:"txid"`
+	Confirmed bool   `json:"confirmed"`
+
+	// Set when the transaction itself signals BIP125 replaceability
+	SignalsRBF bool `json:"signals_rbf"`
+
+	// Set when the transaction signals replaceability, either directly or
+	// inherited from any of its unconfirmed ancestors
+	Replaceable bool `json:"replaceable"`
+
+	Fee     int64   `json:"fee"`
+	VSize   uint32  `json:"vsize"`
+	FeeRate float64 `json:"fee_rate"`
+
+	// Unconfirmed transactions that must be mined along with (or before) this one
+	Ancestors []Ancestor `json:"ancestors"`
+
+	// Aggregated values for the transaction and all its unconfirmed ancestors,
+	// i.e. the effective fee rate a miner would consider
+	PackageFee     int64   `json:"package_fee"`
+	PackageVSize   uint32  `json:"package_vsize"`
+	PackageFeeRate float64 `json:"package_fee_rate"`
+}
+
+// SignalsRBF reports whether the transaction explicitly signals BIP125 replaceability
+func SignalsRBF(tx *VerboseTx) bool {
+	for _, vin := range tx.Vin {
+		if vin.Sequence < rbfSequenceThreshold {
+			return true
+		}
+	}
+	return false
+}
+
+// CPFPFee returns the fee, in satoshis, a child transaction of the given virtual size
+// must pay for the whole package to reach the target fee rate (sat/vB)
+func (b *BumpInfo) CPFPFee(feeRate float64, childVSize uint32) int64 {
+	required := int64(feeRate*float64(b.PackageVSize+childVSize) + 0.5)
+	if fee := required - b.PackageFee; fee > 0 {
+		return fee
+	}
+	return 0
+}
+
+// AnalyzeBump reports whether a pending transaction can be replaced (BIP125) or accelerated
+// by spending one of its outputs (CPFP). Mempool entries, as returned by 'ScriptHashMempool',
+// are used to resolve fees without additional requests when available; any other fee is
+// calculated by enriching the transaction inputs
+func (c *Client) AnalyzeBump(tx *VerboseTx, mempool []MempoolTx) (*BumpInfo, error) {
+	info := &BumpInfo{
+		TxID:       tx.TxID,
+		Confirmed:  tx.Confirmations > 0,
+		SignalsRBF: SignalsRBF(tx),
+	}
+	if info.Confirmed {
+		return info, nil
+	}
+
+	fees := make(map[string]int64, len(mempool))
+	walk := true
+	for _, m := range mempool {
+		fees[m.Hash] = int64(m.Fee)
+
+		// A height of 0 indicates all the inputs of the entry are confirmed
+		if m.Hash == tx.TxID && m.Height == 0 {
+			walk = false
+		}
+	}
+
+	// Parents are shared by the fee calculation and the ancestors walk, each one is
+	// requested once
+	parents := make(map[string]*VerboseTx)
+	fee, err := c.mempoolFee(tx, fees, parents)
+	if err != nil {
+		return nil, err
+	}
+
+	var ancestors []Ancestor
+	if walk {
+		if ancestors, err = c.unconfirmedAncestors(tx, fees, parents); err != nil {
+			return nil, err
+		}
+	}
+
+	info.fill(fee, txVSize(tx), ancestors)
+	return info, nil
+}
+
+// Calculate the fee and package values for the transaction
+func (b *BumpInfo) fill(fee int64, vsize uint32, ancestors []Ancestor) {
+	b.Fee = fee
+	b.VSize = vsize
+	b.Ancestors = ancestors
+	b.Replaceable = b.SignalsRBF
+	b.PackageFee = fee
+	b.PackageVSize = vsize
+	for _, a := range ancestors {
+		b.PackageFee += a.Fee
+		b.PackageVSize += a.VSize
+		if a.SignalsRBF {
+			b.Replaceable = true
+		}
+	}
+	if b.VSize > 0 {
+		b.FeeRate = float64(b.Fee) / float64(b.VSize)
+	}
+	if b.PackageVSize > 0 {
+		b.PackageFeeRate = float64(b.PackageFee) / float64(b.PackageVSize)
+	}
+}
+
+// Walk the inputs of the transaction collecting all parents still waiting for confirmation
+func (c *Client) unconfirmedAncestors(tx *VerboseTx, fees map[string]int64, fetched map[string]*VerboseTx) ([]Ancestor, error) {
+	var ancestors []Ancestor
+	seen := map[string]bool{tx.TxID: true}
+	pending := []*VerboseTx{tx}
+	for len(pending) > 0 {
+		var parents []string
+		for _, p := range pending {
+			for _, vin := range p.Vin {
+				if isCoinbase(&vin) || seen[vin.TxID] {
+					continue
+				}
+				seen[vin.TxID] = true
+				parents = append(parents, vin.TxID)
+			}
+		}
+
+		if err := c.fetchMissing(parents, fetched); err != nil {
+			return nil, err
+		}
+
+		pending = nil
+		for _, hash := range parents {
+			parent := fetched[hash]
+			if parent.Confirmations > 0 {
+				continue
+			}
+			fee, err := c.mempoolFee(parent, fees, fetched)
+			if err != nil {
+				return nil, err
+			}
+			ancestors = append(ancestors, Ancestor{
+				TxID:       parent.TxID,
+				Fee:        fee,
+				VSize:      txVSize(parent),
+				SignalsRBF: SignalsRBF(parent),
+			})
+			pending = append(pending, parent)
+		}
+	}
+	return ancestors, nil
+}
+
+// Resolve the fee paid by a transaction, in satoshis
+func (c *Client) mempoolFee(tx *VerboseTx, fees map[string]int64, fetched map[string]*VerboseTx) (int64, error) {
+	if fee, ok := fees[tx.TxID]; ok {
+		return fee, nil
+	}
+
+	if err := c.fetchMissing(prevoutHashes(tx.Vin), fetched); err != nil {
+		return 0, err
+	}
+	vins, err := linkPrevouts(tx.Vin, fetched)
+	if err != nil {
+		return 0, err
+	}
+
+	var fee int64
+	for _, vin := range vins {
+		if vin.Prevout != nil {
+			fee += toSat(vin.Prevout.Value)
+		}
+	}
+	for _, vout := range tx.Vout {
+		fee -= toSat(vout.Value)
+	}
+	fees[tx.TxID] = fee
+	return fee, nil
+}
+
+// Fetch the transactions not retrieved yet, adding them to the fetched ones
+func (c *Client) fetchMissing(hashes []string, fetched map[string]*VerboseTx) error {
+	var missing []string
+	for _, hash := range hashes {
+		if _, ok := fetched[hash]; !ok {
+			fetched[hash] = nil
+			missing = append(missing, hash)
+		}
+	}
+
+	txs, err := c.getVerboseTransactions(missing)
+	if err != nil {
+		for _, hash := range missing {
+			delete(fetched, hash)
+		}
+		return err
+	}
+	for i, tx := range txs {
+		fetched[missing[i]] = tx
+	}
+	return nil
+}
+
+// Virtual size of the transaction; servers without segwit support only report the raw size
+func txVSize(tx *VerboseTx) uint32 {
+	if tx.VSize > 0 {
+		return tx.VSize
+	}
+	return tx.Size
+}
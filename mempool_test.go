@@ -0,0 +1,208 @@
+package electrum
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestSignalsRBF(t *testing.T) {
+	cases := map[string]struct {
+		sequences []uint32
+		expected  bool
+	}{
+		"final":     {[]uint32{0xffffffff, 0xffffffff}, false},
+		"locktime":  {[]uint32{0xfffffffe}, false},
+		"signaling": {[]uint32{0xfffffffd}, true},
+		"mixed":     {[]uint32{0xffffffff, 0}, true},
+		"no inputs": {nil, false},
+		"relative":  {[]uint32{144}, true},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			tx := &VerboseTx{}
+			for _, seq := range tc.sequences {
+				tx.Vin = append(tx.Vin, Vin{Sequence: seq})
+			}
+			if got := SignalsRBF(tx); got != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestBumpInfo(t *testing.T) {
+	info := &BumpInfo{TxID: "child"}
+	info.fill(200, 200, []Ancestor{
+		{TxID: "parent", Fee: 100, VSize: 300, SignalsRBF: true},
+		{TxID: "grandparent", Fee: 300, VSize: 100},
+	})
+
+	t.Run("FeeRate", func(t *testing.T) {
+		if info.FeeRate != 1 {
+			t.Errorf("unexpected fee rate: %v", info.FeeRate)
+		}
+		if info.PackageFee != 600 || info.PackageVSize != 600 || info.PackageFeeRate != 1 {
+			t.Errorf("unexpected package: %+v", info)
+		}
+	})
+
+	t.Run("Replaceable", func(t *testing.T) {
+		if info.SignalsRBF || !info.Replaceable {
+			t.Errorf("expected inherited replaceability: %+v", info)
+		}
+	})
+
+	t.Run("CPFPFee", func(t *testing.T) {
+		if fee := info.CPFPFee(5, 150); fee != 3150 {
+			t.Errorf("unexpected child fee: %d", fee)
+		}
+		if fee := info.CPFPFee(0.5, 150); fee != 0 {
+			t.Errorf("unexpected child fee: %d", fee)
+		}
+	})
+}
+
+func TestAnalyzeBump(t *testing.T) {
+	id := func(n int) string { return fmt.Sprintf("%064x", n) }
+	funding, grandparent, parent, child := id(1), id(2), id(3), id(4)
+	txs := map[string]*VerboseTx{
+		funding: {TxID: funding, Confirmations: 10, Vout: []Vout{{N: 0, Value: 1}}},
+		grandparent: {
+			TxID:  grandparent,
+			VSize: 100,
+			Vin:   []Vin{{TxID: funding, Vout: 0, Sequence: 0xffffffff}},
+			Vout:  []Vout{{N: 0, Value: 0.9999}},
+		},
+		parent: {
+			TxID:  parent,
+			VSize: 200,
+			Vin:   []Vin{{TxID: grandparent, Vout: 0, Sequence: 0xfffffffd}},
+			Vout:  []Vout{{N: 0, Value: 0.99985}},
+		},
+		child: {
+			TxID:  child,
+			VSize: 100,
+			Vin:   []Vin{{TxID: parent, Vout: 0, Sequence: 0xffffffff}},
+			Vout:  []Vout{{N: 0, Value: 0.9998}},
+		},
+	}
+
+	var mu sync.Mutex
+	requests := map[string]int{}
+	client := newMockClient(t, nil, func(method string, params []json.RawMessage) (any, *RPCError) {
+		if method != "blockchain.transaction.get" {
+			return nil, &RPCError{Code: -32601, Message: "unknown method"}
+		}
+		var hash string
+		if err := json.Unmarshal(params[0], &hash); err != nil {
+			return nil, &RPCError{Message: err.Error()}
+		}
+		mu.Lock()
+		requests[hash]++
+		mu.Unlock()
+		if tx, ok := txs[hash]; ok {
+			return tx, nil
+		}
+		return nil, &RPCError{Code: 2, Message: "No such mempool or blockchain transaction"}
+	})
+
+	t.Run("Ancestors", func(t *testing.T) {
+		mempool := []MempoolTx{
+			{Tx: Tx{Hash: parent, Height: -1}, Fee: 5000},
+			{Tx: Tx{Hash: child, Height: -1}, Fee: 5000},
+		}
+		info, err := client.AnalyzeBump(txs[child], mempool)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Confirmed || info.SignalsRBF || !info.Replaceable {
+			t.Errorf("expected replaceability inherited from the parent: %+v", info)
+		}
+		if info.Fee != 5000 || info.VSize != 100 || info.FeeRate != 50 {
+			t.Errorf("unexpected fee: %+v", info)
+		}
+		expected := []Ancestor{
+			{TxID: parent, Fee: 5000, VSize: 200, SignalsRBF: true},
+			{TxID: grandparent, Fee: 10000, VSize: 100},
+		}
+		if !reflect.DeepEqual(info.Ancestors, expected) {
+			t.Errorf("unexpected ancestors: %+v", info.Ancestors)
+		}
+		if info.PackageFee != 20000 || info.PackageVSize != 400 || info.PackageFeeRate != 50 {
+			t.Errorf("unexpected package: %+v", info)
+		}
+		if fee := info.CPFPFee(100, 100); fee != 30000 {
+			t.Errorf("unexpected child fee: %d", fee)
+		}
+
+		// Fees listed in the mempool entries are used without fetching the inputs
+		mu.Lock()
+		defer mu.Unlock()
+		if requests[child] != 0 || requests[parent] != 1 || requests[funding] == 0 {
+			t.Errorf("unexpected requests: %v", requests)
+		}
+	})
+
+	t.Run("Fetched", func(t *testing.T) {
+		mu.Lock()
+		requests = map[string]int{}
+		mu.Unlock()
+
+		// Without mempool entries fees are calculated from the parents, which are
+		// also walked as ancestors; each one is requested once
+		info, err := client.AnalyzeBump(txs[child], nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Fee != 5000 || info.PackageFee != 20000 || len(info.Ancestors) != 2 {
+			t.Errorf("unexpected analysis: %+v", info)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for hash, n := range requests {
+			if n > 1 {
+				t.Errorf("transaction %s requested %d times", hash, n)
+			}
+		}
+		if requests[parent] != 1 || requests[grandparent] != 1 {
+			t.Errorf("unexpected requests: %v", requests)
+		}
+	})
+
+	t.Run("ConfirmedInputs", func(t *testing.T) {
+		tx := &VerboseTx{
+			TxID: id(5),
+			Size: 250,
+			Vin:  []Vin{{TxID: funding, Vout: 0, Sequence: 0xfffffffd}},
+			Vout: []Vout{{N: 0, Value: 0.99}},
+		}
+		info, err := client.AnalyzeBump(tx, []MempoolTx{{Tx: Tx{Hash: tx.TxID}, Fee: 1_000_000}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.SignalsRBF || !info.Replaceable || len(info.Ancestors) != 0 {
+			t.Errorf("unexpected replaceability: %+v", info)
+		}
+		if info.VSize != 250 || info.PackageFee != 1_000_000 || info.FeeRate != 4000 {
+			t.Errorf("unexpected fee: %+v", info)
+		}
+	})
+
+	t.Run("Unknown", func(t *testing.T) {
+		tx := &VerboseTx{TxID: id(6), Vin: []Vin{{TxID: id(7), Sequence: 0xffffffff}}}
+		if _, err := client.AnalyzeBump(tx, nil); !errors.Is(err, ErrDaemonError) {
+			t.Errorf("expected the missing parent to be reported, got %v", err)
+		}
+	})
+
+	t.Run("Confirmed", func(t *testing.T) {
+		info, err := client.AnalyzeBump(txs[funding], nil)
+		if err != nil || !info.Confirmed || info.Replaceable || info.Fee != 0 {
+			t.Errorf("unexpected result for a confirmed transaction: %+v, %v", info, err)
+		}
+	})
+}
@@ -0,0 +1,114 @@
+package electrum
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"sync"
+	"testing"
+)
+
+// Handler used by the mock server to produce the result of a single request
+type mockHandler func(method string, params []json.RawMessage) (any, *RPCError)
+
+// Result value instructing the mock server to omit the response
+var mockSkip = new(struct{})
+
+type mockRequest struct {
+	ID     int               `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+type mockResponse struct {
+	RPC    string    `json:"jsonrpc"`
+	ID     int       `json:"id"`
+	Result any       `json:"result,omitempty"`
+	Error  *RPCError `json:"error,omitempty"`
+}
+
+// Start a local server speaking the line-delimited JSON-RPC protocol; every message
+// is processed concurrently to mimic a real server
+func mockServer(t *testing.T, handler mockHandler) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveMock(conn, handler)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func serveMock(conn net.Conn, handler mockHandler) {
+	defer conn.Close()
+	var mu sync.Mutex
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadBytes(delimiter)
+		if err != nil {
+			return
+		}
+		go func() {
+			var out any
+			if line[0] == '[' {
+				var reqs []mockRequest
+				if json.Unmarshal(line, &reqs) != nil {
+					return
+				}
+				batch := []mockResponse{}
+				for _, req := range reqs {
+					if res := handleMock(handler, req); res.Result != mockSkip {
+						batch = append(batch, res)
+					}
+				}
+				out = batch
+			} else {
+				var req mockRequest
+				if json.Unmarshal(line, &req) != nil {
+					return
+				}
+				res := handleMock(handler, req)
+				if res.Result == mockSkip {
+					return
+				}
+				out = res
+			}
+
+			b, _ := json.Marshal(out)
+			mu.Lock()
+			defer mu.Unlock()
+			_, _ = conn.Write(append(b, delimiter))
+		}()
+	}
+}
+
+func handleMock(handler mockHandler, req mockRequest) mockResponse {
+	result, rpcErr := handler(req.Method, req.Params)
+	return mockResponse{RPC: "2.0", ID: req.ID, Result: result, Error: rpcErr}
+}
+
+// Start a client connected to a mock server
+func newMockClient(t *testing.T, options *Options, handler mockHandler) *Client {
+	if options == nil {
+		options = &Options{}
+	}
+	options.Address = mockServer(t, handler)
+	if options.Cache == nil {
+		options.Cache = NewMemoryCache(0)
+	}
+	client, err := New(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+	return client
+}
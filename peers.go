@@ -0,0 +1,327 @@
+package electrum
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Ports assumed for peers announcing a transport without one
+const (
+	defaultTCPPort = 50001
+	defaultSSLPort = 50002
+)
+
+// Parse the features announced for a peer: 'v' followed by the maximum protocol version,
+// 's' and 't' followed by the SSL and TCP ports, and 'p' followed by the pruning limit.
+// Unknown or malformed features are ignored
+func (p *Peer) parseFeatures() {
+	for _, f := range p.Features {
+		if f == "" {
+			continue
+		}
+		value := f[1:]
+		switch f[0] {
+		case 'v':
+			p.ProtocolMax = value
+		case 's':
+			p.SSLPort = featurePort(value, defaultSSLPort)
+		case 't':
+			p.TCPPort = featurePort(value, defaultTCPPort)
+		case 'p':
+			if n, err := strconv.ParseUint(value, 10, 64); err == nil {
+				p.Pruning = n
+			}
+		}
+	}
+}
+
+func featurePort(value string, fallback uint) uint {
+	if value == "" {
+		return fallback
+	}
+	port, err := strconv.ParseUint(value, 10, 16)
+	if err != nil {
+		return 0
+	}
+	return uint(port)
+}
+
+// Host used to reach the peer, its hostname when known
+func (p *Peer) host() string {
+	if p.Name != "" {
+		return p.Name
+	}
+	return p.Address
+}
+
+// Compare two protocol versions, e.g. '1.4' and '1.4.2', missing components count as zero
+func compareProtocol(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// CrawlOptions adjust the discovery of peer servers
+type CrawlOptions struct {
+	// Additional servers to start from, along with the peers of the client's server
+	Seeds []*Peer
+
+	// Genesis hash candidates must report, defaults to the one of the client's server
+	GenesisHash string
+
+	// Protocol version candidates must support, defaults to the one used by the client
+	Protocol string
+
+	// Used to connect to peers over SSL, the server name is set to the peer hostname
+	// when empty. Peers are verified against the system roots by default
+	TLS *tls.Config
+
+	// Prefer TCP connections when peers support both transports
+	PreferTCP bool
+
+	// The maximum number of peers checked, defaults to 100
+	MaxPeers int
+
+	// The maximum number of peers checked concurrently, defaults to 8
+	Concurrency int
+
+	// Timeout for the network operations of every peer, defaults to 10 seconds
+	Timeout time.Duration
+}
+
+// PeerCandidate is a peer server found to be serving the expected chain and protocol
+type PeerCandidate struct {
+	Peer *Peer
+
+	// Address dialed, and whether the connection used SSL
+	Address string
+	TLS     bool
+
+	// Features reported by the peer
+	Info *ServerInfo
+
+	// Time taken to negotiate the protocol version
+	Latency time.Duration
+}
+
+// CrawlPeers discovers servers walking the peers reported by the client's server, and in
+// turn by every peer found, until 'MaxPeers' are checked. Each peer is connected to and
+// required to report the expected genesis hash and support the expected protocol version.
+// Candidates are ranked by preference: SSL connections first, then servers keeping the
+// whole history, then by latency. Onion peers are skipped
+func (c *Client) CrawlPeers(ctx context.Context, opts *CrawlOptions) ([]*PeerCandidate, error) {
+	if opts == nil {
+		opts = &CrawlOptions{}
+	}
+	cr := &crawler{
+		c:    c,
+		opts: *opts,
+		seen: make(map[string]bool),
+	}
+	if cr.opts.Protocol == "" {
+		cr.opts.Protocol = c.Protocol
+	}
+	if cr.opts.MaxPeers <= 0 {
+		cr.opts.MaxPeers = 100
+	}
+	if cr.opts.Concurrency <= 0 {
+		cr.opts.Concurrency = 8
+	}
+	if cr.opts.Timeout == 0 {
+		cr.opts.Timeout = 10 * time.Second
+	}
+	if cr.opts.GenesisHash == "" {
+		info, err := c.serverFeatures(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error crawling peers: %w", err)
+		}
+		cr.opts.GenesisHash = info.GenesisHash
+	}
+	cr.sem = make(chan struct{}, cr.opts.Concurrency)
+
+	peers, err := c.serverPeers(ctx)
+	if err != nil && len(opts.Seeds) == 0 {
+		return nil, fmt.Errorf("error crawling peers: %w", err)
+	}
+	cr.seen[c.Address] = true
+
+	// Seeds may provide their ports either directly or as features
+	seeds := make([]*Peer, 0, len(opts.Seeds)+len(peers))
+	for _, s := range opts.Seeds {
+		seed := *s
+		if len(seed.Features) > 0 {
+			seed.parseFeatures()
+		}
+		seeds = append(seeds, &seed)
+	}
+	cr.visit(ctx, append(seeds, peers...))
+	cr.wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(cr.found, func(i, j int) bool {
+		a, b := cr.found[i], cr.found[j]
+		if a.TLS != b.TLS {
+			return a.TLS
+		}
+		if (a.Peer.Pruning == 0) != (b.Peer.Pruning == 0) {
+			return a.Peer.Pruning == 0
+		}
+		return a.Latency < b.Latency
+	})
+	return cr.found, nil
+}
+
+// State of a peer discovery walk
+type crawler struct {
+	c    *Client
+	opts CrawlOptions
+	sem  chan struct{}
+	wg   sync.WaitGroup
+
+	mu      sync.Mutex
+	seen    map[string]bool
+	checked int
+	found   []*PeerCandidate
+}
+
+// Check the peers not seen before, and the peers they report in turn
+func (cr *crawler) visit(ctx context.Context, peers []*Peer) {
+	for _, p := range peers {
+		address, useTLS := cr.endpoint(p)
+		if address == "" {
+			continue
+		}
+
+		cr.mu.Lock()
+		skip := cr.seen[address] || cr.checked >= cr.opts.MaxPeers
+		if !skip {
+			cr.seen[address] = true
+			cr.checked++
+		}
+		cr.mu.Unlock()
+		if skip {
+			continue
+		}
+
+		cr.wg.Add(1)
+		go func(candidate *PeerCandidate) {
+			defer cr.wg.Done()
+			select {
+			case cr.sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			peers, err := cr.check(ctx, candidate)
+			<-cr.sem
+			if err != nil {
+				cr.c.debug("peer %s rejected: %v", candidate.Address, err)
+				return
+			}
+
+			cr.mu.Lock()
+			cr.found = append(cr.found, candidate)
+			cr.mu.Unlock()
+			cr.visit(ctx, peers)
+		}(&PeerCandidate{Peer: p, Address: address, TLS: useTLS})
+	}
+}
+
+// Address to reach a peer at, and whether to use SSL; empty if the peer can't be reached
+// or doesn't support the expected protocol version
+func (cr *crawler) endpoint(p *Peer) (string, bool) {
+	host := p.host()
+	if host == "" || strings.HasSuffix(host, ".onion") {
+		return "", false
+	}
+	if p.ProtocolMax != "" && compareProtocol(p.ProtocolMax, cr.opts.Protocol) < 0 {
+		return "", false
+	}
+	switch {
+	case p.SSLPort != 0 && (p.TCPPort == 0 || !cr.opts.PreferTCP):
+		return net.JoinHostPort(host, strconv.Itoa(int(p.SSLPort))), true
+	case p.TCPPort != 0:
+		return net.JoinHostPort(host, strconv.Itoa(int(p.TCPPort))), false
+	}
+	return "", false
+}
+
+// Connect to a peer and verify the chain and protocol it serves, returning the peers it knows.
+// The whole check is bounded by the timeout, as well as the context
+func (cr *crawler) check(ctx context.Context, candidate *PeerCandidate) ([]*Peer, error) {
+	ctx, cancel := context.WithTimeout(ctx, cr.opts.Timeout)
+	defer cancel()
+
+	options := &Options{
+		Address:  candidate.Address,
+		Protocol: cr.opts.Protocol,
+		Cache:    NoCache,
+		Log:      cr.c.log,
+	}
+	if candidate.TLS {
+		options.TLS = &tls.Config{}
+		if cr.opts.TLS != nil {
+			options.TLS = cr.opts.TLS.Clone()
+		}
+		if options.TLS.ServerName == "" {
+			options.TLS.ServerName = candidate.Peer.host()
+		}
+	}
+
+	deadline, _ := ctx.Deadline()
+	if options.Timeout = time.Until(deadline); options.Timeout <= 0 {
+		return nil, context.DeadlineExceeded
+	}
+	client, err := New(options)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	start := time.Now()
+	if _, err := client.serverVersion(ctx); err != nil {
+		return nil, err
+	}
+	candidate.Latency = time.Since(start)
+
+	info, err := client.serverFeatures(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if info.GenesisHash != cr.opts.GenesisHash {
+		return nil, fmt.Errorf("serving a different chain, genesis %s", info.GenesisHash)
+	}
+	if compareProtocol(info.ProtocolMin, cr.opts.Protocol) > 0 || compareProtocol(info.ProtocolMax, cr.opts.Protocol) < 0 {
+		return nil, fmt.Errorf("protocol %s not supported, range %s to %s", cr.opts.Protocol, info.ProtocolMin, info.ProtocolMax)
+	}
+	candidate.Info = info
+
+	// Peer discovery may be disabled, the candidate is still valid
+	peers, err := client.serverPeers(ctx)
+	if err != nil {
+		cr.c.debug("peer %s didn't report its peers: %v", candidate.Address, err)
+	}
+	return peers, nil
+}
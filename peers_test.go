@@ -0,0 +1,128 @@
+package electrum
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPeerFeatures(t *testing.T) {
+	p := &Peer{Features: []string{"v1.4", "s", "t50011", "p10000", "tx", "x"}}
+	p.parseFeatures()
+	if p.ProtocolMax != "1.4" || p.SSLPort != defaultSSLPort || p.TCPPort != 0 || p.Pruning != 10000 {
+		t.Errorf("unexpected features: %+v", p)
+	}
+
+	for _, c := range []struct {
+		a, b string
+		cmp  int
+	}{{"1.4", "1.4.2", -1}, {"1.4.0", "1.4", 0}, {"1.10", "1.4.2", 1}} {
+		if cmp := compareProtocol(c.a, c.b); cmp != c.cmp {
+			t.Errorf("compare %s and %s: expected %d, got %d", c.a, c.b, c.cmp, cmp)
+		}
+	}
+}
+
+func TestCrawlPeers(t *testing.T) {
+	const genesis = "000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f"
+
+	// Peer entry announcing a server on the given address
+	announce := func(addr string, features ...string) []any {
+		host, port, _ := net.SplitHostPort(addr)
+		return []any{host, host, append([]string{"v1.4.2", "t" + port}, features...)}
+	}
+	server := func(info *ServerInfo, peers func() [][]any) string {
+		return mockServer(t, func(method string, params []json.RawMessage) (any, *RPCError) {
+			switch method {
+			case "server.version":
+				return []string{"mock", Protocol14_2}, nil
+			case "server.features":
+				return info, nil
+			case "server.peers.subscribe":
+				return peers(), nil
+			}
+			return nil, &RPCError{Code: -32601, Message: "unknown method"}
+		})
+	}
+	none := func() [][]any { return nil }
+	valid := &ServerInfo{GenesisHash: genesis, ProtocolMin: "1.4", ProtocolMax: "1.4.2"}
+
+	testnet := server(&ServerInfo{GenesisHash: "aa", ProtocolMin: "1.4", ProtocolMax: "1.4.2"}, none)
+	outdated := server(&ServerInfo{GenesisHash: genesis, ProtocolMin: "1.0", ProtocolMax: "1.2"}, none)
+	pruned := server(valid, none)
+	broken := server(nil, none)
+	var mu sync.Mutex
+	var origin string
+	full := server(valid, func() [][]any {
+		mu.Lock()
+		defer mu.Unlock()
+		return [][]any{announce(pruned, "p1000"), announce(outdated), announce(origin)}
+	})
+	mu.Lock()
+	origin = server(valid, func() [][]any {
+		return [][]any{
+			announce(full),
+			announce(testnet),
+			announce(broken),
+			{"", "abcdef.onion", []string{"v1.4.2", "t50001"}},
+		}
+	})
+	mu.Unlock()
+
+	client, err := New(&Options{Address: origin, Cache: NoCache})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+
+	candidates, err := client.CrawlPeers(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candidates) != 2 {
+		t.Fatalf("expected 2 candidates, got %d", len(candidates))
+	}
+	if candidates[0].Address != full || candidates[1].Address != pruned || candidates[1].Peer.Pruning != 1000 {
+		t.Errorf("unexpected ranking: %+v, %+v", candidates[0], candidates[1])
+	}
+	if candidates[0].Info.GenesisHash != genesis {
+		t.Errorf("unexpected features: %+v", candidates[0].Info)
+	}
+
+	// Limited walk starting from a seed
+	_, port, _ := net.SplitHostPort(pruned)
+	candidates, err = client.CrawlPeers(context.Background(), &CrawlOptions{
+		Seeds:    []*Peer{{Address: "127.0.0.1", Features: []string{"t" + port}}},
+		MaxPeers: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candidates) != 1 || candidates[0].Address != pruned {
+		t.Errorf("unexpected candidates: %+v", candidates)
+	}
+
+	// Checks hanging on unresponsive peers are bounded by the timeout and the context
+	hung := mockServer(t, func(method string, params []json.RawMessage) (any, *RPCError) {
+		return mockSkip, nil
+	})
+	_, port, _ = net.SplitHostPort(hung)
+	seeds := []*Peer{{Address: "127.0.0.1", Features: []string{"t" + port}}}
+	start := time.Now()
+	candidates, err = client.CrawlPeers(context.Background(), &CrawlOptions{Seeds: seeds, Timeout: 100 * time.Millisecond})
+	if err != nil || len(candidates) != 2 {
+		t.Errorf("unexpected candidates %+v: %v", candidates, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := client.CrawlPeers(ctx, &CrawlOptions{Seeds: seeds}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("crawling unresponsive peers took %v", elapsed)
+	}
+}
@@ -0,0 +1,259 @@
+package electrum
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// Initial spacing between messages once the server reports excessive resource usage,
+	// doubled on every report
+	minPenalty = 100 * time.Millisecond
+
+	// Maximum spacing between messages while throttled
+	maxPenalty = 30 * time.Second
+
+	// Time without resource usage reports after which the spacing is halved
+	penaltyRecovery = 10 * time.Second
+)
+
+// Priority of a request, higher priority requests are dispatched first
+type Priority int
+
+// Request priorities, from highest to lowest
+const (
+	// User-facing requests
+	PriorityInteractive Priority = iota
+
+	// Default for single requests
+	PriorityNormal
+
+	// Default for batches, e.g. enriching or bulk scripthash lookups
+	PriorityBulk
+
+	numPriorities
+)
+
+type priorityKey struct{}
+
+// WithPriority returns a context dispatching the requests made with it at the given priority
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// Priority carried by the context, or the fallback if none
+func priorityOf(ctx context.Context, fallback Priority) Priority {
+	if p, ok := ctx.Value(priorityKey{}).(Priority); ok && p >= 0 && p < numPriorities {
+		return p
+	}
+	return fallback
+}
+
+// Paces the messages sent to the server: bounds the number of requests awaiting a response,
+// overall and per priority lane, enforces a token-bucket rate limit, and spaces messages
+// further apart while the server reports excessive resource usage
+type scheduler struct {
+	mu sync.Mutex
+
+	// Requests awaiting a response, unlimited if zero
+	maxInFlight int
+	inFlight    int
+	lanes       [numPriorities]lane
+
+	// Token bucket, unlimited if the rate is zero; negative while repaying large batches
+	rate   float64
+	burst  float64
+	tokens float64
+	filled time.Time
+
+	// Adaptive slowdown
+	penalty   time.Duration
+	throttled time.Time
+	nextSend  time.Time
+
+	// Resumes dispatching once the request waiting for tokens or spacing can be sent
+	wake   *time.Timer
+	wakeAt time.Time
+}
+
+// Requests of a priority class, waiting in arrival order
+type lane struct {
+	limit    int
+	inFlight int
+	waiting  []*waiter
+}
+
+// Request waiting for in-flight capacity and tokens, 'ready' is closed once admitted
+type waiter struct {
+	n     int
+	ready chan struct{}
+}
+
+func newScheduler(maxInFlight uint32, laneLimits map[Priority]uint32, rate float64, burst uint32) *scheduler {
+	s := &scheduler{
+		maxInFlight: int(maxInFlight),
+		rate:        rate,
+		burst:       float64(burst),
+		filled:      time.Now(),
+	}
+	for p, limit := range laneLimits {
+		if p >= 0 && p < numPriorities {
+			s.lanes[p].limit = int(limit)
+		}
+	}
+	if s.burst < 1 {
+		s.burst = max(1, rate)
+	}
+	s.tokens = s.burst
+	return s
+}
+
+// Wait until 'n' requests of the given priority can be sent, both in-flight capacity and
+// rate limit tokens are granted in priority order; the capacity taken must be returned with
+// 'release' once their responses are received
+func (s *scheduler) acquire(ctx context.Context, p Priority, n int) error {
+	w := &waiter{n: n, ready: make(chan struct{})}
+	s.mu.Lock()
+	s.lanes[p].waiting = append(s.lanes[p].waiting, w)
+	s.dispatch()
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+	case <-ctx.Done():
+		s.mu.Lock()
+		select {
+		case <-w.ready:
+			s.mu.Unlock()
+			s.release(p, n)
+		default:
+			s.lanes[p].remove(w)
+			s.dispatch()
+			s.mu.Unlock()
+		}
+		return ctx.Err()
+	}
+	return nil
+}
+
+// Return the capacity taken by 'n' requests of the given priority
+func (s *scheduler) release(p Priority, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inFlight -= n
+	s.lanes[p].inFlight -= n
+	s.dispatch()
+}
+
+// Admit waiting requests in priority order; a lane stalled by its own limit doesn't hold
+// back lower priorities, while one stalled by the overall limit or waiting for tokens does,
+// so the tokens go to the highest priority first. Requests larger than a limit are admitted
+// once nothing else is in flight. Must be called while holding the lock
+func (s *scheduler) dispatch() {
+	for p := range s.lanes {
+		l := &s.lanes[p]
+		for len(l.waiting) > 0 {
+			w := l.waiting[0]
+			if !fits(s.inFlight, w.n, s.maxInFlight) {
+				return
+			}
+			if !fits(l.inFlight, w.n, l.limit) {
+				break
+			}
+			if wait := s.reserve(w.n); wait > 0 {
+				s.wakeAfter(wait)
+				return
+			}
+			l.waiting = l.waiting[1:]
+			s.inFlight += w.n
+			l.inFlight += w.n
+			close(w.ready)
+		}
+	}
+}
+
+// Dispatch again once the given time elapses, unless already due earlier. Must be called
+// while holding the lock
+func (s *scheduler) wakeAfter(wait time.Duration) {
+	at := time.Now().Add(wait)
+	if s.wake != nil && !s.wakeAt.After(at) {
+		return
+	}
+	if s.wake != nil {
+		s.wake.Stop()
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(wait, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.wake == timer {
+			s.wake = nil
+		}
+		s.dispatch()
+	})
+	s.wake, s.wakeAt = timer, at
+}
+
+// Reports whether 'n' more requests fit within a limit, zero meaning unlimited
+func fits(inFlight, n, limit int) bool {
+	return limit <= 0 || inFlight == 0 || inFlight+n <= limit
+}
+
+func (l *lane) remove(w *waiter) {
+	for i, other := range l.waiting {
+		if other == w {
+			l.waiting = append(l.waiting[:i], l.waiting[i+1:]...)
+			return
+		}
+	}
+}
+
+// Consume the tokens required by 'n' requests, or report how long to wait for them. Must
+// be called while holding the lock
+func (s *scheduler) reserve(n int) time.Duration {
+	now := time.Now()
+	if s.penalty > 0 && now.Sub(s.throttled) >= penaltyRecovery {
+		s.penalty /= 2
+		s.throttled = now
+		if s.penalty < minPenalty {
+			s.penalty = 0
+		}
+	}
+	if wait := s.nextSend.Sub(now); wait > 0 {
+		return wait
+	}
+
+	if s.rate > 0 {
+		s.tokens = min(s.burst, s.tokens+now.Sub(s.filled).Seconds()*s.rate)
+		s.filled = now
+
+		// Batches larger than the bucket wait for it to be full, then are charged in full
+		// leaving the bucket in debt, so the following messages wait for it to be repaid
+		need := min(float64(n), s.burst)
+		if s.tokens < need {
+			return time.Duration((need - s.tokens) / s.rate * float64(time.Second))
+		}
+		s.tokens -= float64(n)
+	}
+
+	s.nextSend = now.Add(s.penalty)
+	return 0
+}
+
+// Slow down when the server reports excessive resource usage
+func (s *scheduler) observe(resp *response) {
+	if resp == nil || resp.Error == nil {
+		return
+	}
+	if !errors.Is(resp.Error, ErrExcessiveResourceUsage) && !errors.Is(resp.Error, ErrServerBusy) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.penalty = min(max(minPenalty, s.penalty*2), maxPenalty)
+	s.throttled = time.Now()
+}
@@ -0,0 +1,212 @@
+package electrum
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestScheduler(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("InFlight", func(t *testing.T) {
+		s := newScheduler(2, nil, 0, 0)
+		if err := s.acquire(ctx, PriorityNormal, 2); err != nil {
+			t.Fatal(err)
+		}
+		short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		if err := s.acquire(short, PriorityNormal, 1); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected to wait for a free slot, got %v", err)
+		}
+		s.release(PriorityNormal, 2)
+		if err := s.acquire(ctx, PriorityBulk, 5); err != nil {
+			t.Errorf("expected large batches to be admitted when idle: %v", err)
+		}
+	})
+
+	t.Run("Priority", func(t *testing.T) {
+		s := newScheduler(2, map[Priority]uint32{PriorityBulk: 1}, 0, 0)
+		if err := s.acquire(ctx, PriorityBulk, 1); err != nil {
+			t.Fatal(err)
+		}
+
+		// The bulk lane is full, other lanes still make progress
+		if err := s.acquire(ctx, PriorityNormal, 1); err != nil {
+			t.Fatal(err)
+		}
+
+		order := make(chan Priority, 3)
+		for i, p := range []Priority{PriorityBulk, PriorityNormal, PriorityInteractive} {
+			go func(p Priority) {
+				if s.acquire(ctx, p, 1) == nil {
+					order <- p
+				}
+			}(p)
+			waitQueued(t, s, i+1)
+		}
+
+		s.release(PriorityNormal, 1)
+		if p := <-order; p != PriorityInteractive {
+			t.Errorf("expected the interactive request first, got %d", p)
+		}
+		s.release(PriorityInteractive, 1)
+		if p := <-order; p != PriorityNormal {
+			t.Errorf("expected the normal request next, got %d", p)
+		}
+		s.release(PriorityBulk, 1)
+		if p := <-order; p != PriorityBulk {
+			t.Errorf("expected the bulk request last, got %d", p)
+		}
+	})
+
+	t.Run("RateLimit", func(t *testing.T) {
+		s := newScheduler(0, nil, 100, 1)
+		start := time.Now()
+		for i := 0; i < 5; i++ {
+			if err := s.acquire(ctx, PriorityNormal, 1); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if elapsed := time.Since(start); elapsed < 35*time.Millisecond {
+			t.Errorf("rate limit not enforced, took %v", elapsed)
+		}
+	})
+
+	t.Run("LargeBatch", func(t *testing.T) {
+		s := newScheduler(0, nil, 100, 10)
+		if err := s.acquire(ctx, PriorityBulk, 20); err != nil {
+			t.Fatal(err)
+		}
+
+		// The batch is charged in full, the next message waits for the debt to be repaid
+		if wait := s.reserve(1); wait < 90*time.Millisecond {
+			t.Errorf("expected the batch to be charged in full, wait %v", wait)
+		}
+	})
+
+	t.Run("RatePriority", func(t *testing.T) {
+		s := newScheduler(0, nil, 50, 1)
+
+		// The batch leaves the bucket in debt, queued requests get tokens by priority
+		if err := s.acquire(ctx, PriorityBulk, 5); err != nil {
+			t.Fatal(err)
+		}
+		order := make(chan Priority, 2)
+		for i, p := range []Priority{PriorityBulk, PriorityInteractive} {
+			go func(p Priority) {
+				if s.acquire(ctx, p, 1) == nil {
+					order <- p
+				}
+			}(p)
+			waitQueued(t, s, i+1)
+		}
+
+		if p := <-order; p != PriorityInteractive {
+			t.Errorf("expected the interactive request first, got %d", p)
+		}
+		if p := <-order; p != PriorityBulk {
+			t.Errorf("expected the bulk request last, got %d", p)
+		}
+	})
+
+	t.Run("Slowdown", func(t *testing.T) {
+		s := newScheduler(0, nil, 0, 0)
+		s.observe(&response{Error: &RPCError{Code: codeDaemonError}})
+		if s.penalty != 0 {
+			t.Error("unexpected slowdown")
+		}
+		s.observe(&response{Error: &RPCError{Code: codeExcessiveResourceUsage}})
+		s.observe(&response{Error: &RPCError{Code: codeServerBusy}})
+		if s.penalty != 2*minPenalty {
+			t.Errorf("unexpected penalty: %v", s.penalty)
+		}
+
+		if wait := s.reserve(1); wait != 0 {
+			t.Errorf("unexpected wait: %v", wait)
+		}
+		if wait := s.reserve(1); wait < minPenalty {
+			t.Errorf("expected messages to be spaced, wait %v", wait)
+		}
+
+		s.throttled = time.Now().Add(-penaltyRecovery)
+		s.nextSend = time.Time{}
+		s.reserve(1)
+		if s.penalty != minPenalty {
+			t.Errorf("expected the penalty to recover, got %v", s.penalty)
+		}
+	})
+}
+
+func TestCallPriority(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+	client := newMockClient(t, &Options{MaxInFlight: 1}, func(method string, params []json.RawMessage) (any, *RPCError) {
+		mu.Lock()
+		order = append(order, method)
+		mu.Unlock()
+		switch method {
+		case "blockchain.scripthash.get_balance":
+			return &Balance{Confirmed: 1}, nil
+		}
+		return []any{}, nil
+	})
+
+	// Hold the only slot while typed calls queue up in their lanes
+	ctx := context.Background()
+	if err := client.sched.acquire(ctx, PriorityNormal, 1); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	calls := []func(){
+		func() { _, _ = client.ScriptHashHistoryContext(WithPriority(ctx, PriorityBulk), "a") },
+		func() { _, _ = client.ScriptHashMempoolContext(ctx, "a") },
+		func() { _, _ = client.ScriptHashBalanceContext(WithPriority(ctx, PriorityInteractive), "a") },
+	}
+	for i, call := range calls {
+		wg.Add(1)
+		go func(call func()) {
+			defer wg.Done()
+			call()
+		}(call)
+		waitQueued(t, client.sched, i+1)
+	}
+	client.sched.release(PriorityNormal, 1)
+	wg.Wait()
+
+	expected := []string{
+		"blockchain.scripthash.get_balance",
+		"blockchain.scripthash.get_mempool",
+		"blockchain.scripthash.get_history",
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if strings.Join(order, ",") != strings.Join(expected, ",") {
+		t.Errorf("unexpected dispatch order: %v", order)
+	}
+}
+
+// Wait until the given number of requests are queued by the scheduler
+func waitQueued(t *testing.T, s *scheduler, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.mu.Lock()
+		queued := 0
+		for _, l := range s.lanes {
+			queued += len(l.waiting)
+		}
+		s.mu.Unlock()
+		if queued == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d queued requests, got %d", n, queued)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
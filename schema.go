@@ -0,0 +1,135 @@
+package electrum
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+const (
+	// Version of the sqlite cache schema
+	cacheSchemaVersion = 5
+
+	// Version of the cached data model; must be increased whenever the serialized
+	// VerboseTx or RichTx structures change, invalidating all existing entries
+	cacheModelVersion = 1
+)
+
+// Schema migrations, the entry at index i upgrades the schema from version i+1
+var cacheMigrations = [][]string{
+	// Block reference, used to detect entries orphaned by chain reorganizations
+	{
+		"ALTER TABLE tx_cache ADD COLUMN block_hash VARCHAR(64)",
+		"ALTER TABLE tx_cache ADD COLUMN height INTEGER DEFAULT 0",
+		"CREATE INDEX IF NOT EXISTS tx_cache_height ON tx_cache (height)",
+	},
+
+	// Data model version used to serialize each entry
+	{
+		"ALTER TABLE tx_cache ADD COLUMN version INTEGER DEFAULT 0",
+	},
+
+	// Access time, in milliseconds, used to evict the least recently used entries
+	{
+		"ALTER TABLE tx_cache ADD COLUMN last_access INTEGER DEFAULT 0",
+		"CREATE INDEX IF NOT EXISTS tx_cache_last_access ON tx_cache (last_access)",
+	},
+
+	// Auxiliary entries: merkle proofs, block headers and scripthash histories
+	{
+		`CREATE TABLE IF NOT EXISTS cache_items (
+			kind VARCHAR(16),
+			key VARCHAR(128),
+			value TEXT,
+			height INTEGER DEFAULT 0,
+			version INTEGER DEFAULT 0,
+			last_access INTEGER DEFAULT 0,
+			PRIMARY KEY (kind, key)
+		)`,
+		"CREATE INDEX IF NOT EXISTS cache_items_height ON cache_items (height)",
+		"CREATE INDEX IF NOT EXISTS cache_items_last_access ON cache_items (last_access)",
+	},
+}
+
+// Bring the cache database up to date; tables are created using the original schema
+// and upgraded by the migrations. Entries are dropped when the data model changed
+func migrate(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.Exec(`
+	CREATE TABLE IF NOT EXISTS tx_cache (
+		txid VARCHAR(64) PRIMARY KEY,
+		tx TEXT,
+		is_detailed INTEGER DEFAULT 0
+	)
+	`); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`
+	CREATE TABLE IF NOT EXISTS tx_cache_meta (
+		key VARCHAR(32) PRIMARY KEY,
+		value INTEGER
+	)
+	`); err != nil {
+		return err
+	}
+
+	version, err := cacheMeta(tx, "schema_version", 1)
+	if err != nil {
+		return err
+	}
+	if version > cacheSchemaVersion {
+		return fmt.Errorf("unsupported cache schema version %d", version)
+	}
+
+	for ; version < cacheSchemaVersion; version++ {
+		for _, stmt := range cacheMigrations[version-1] {
+			if _, err := tx.Exec(stmt); err != nil {
+				return fmt.Errorf("error migrating cache schema to version %d: %w", version+1, err)
+			}
+		}
+	}
+	if err := setCacheMeta(tx, "schema_version", cacheSchemaVersion); err != nil {
+		return err
+	}
+
+	model, err := cacheMeta(tx, "model_version", 0)
+	if err != nil {
+		return err
+	}
+	if model != cacheModelVersion {
+		for _, table := range []string{"tx_cache", "cache_items"} {
+			if _, err := tx.Exec("DELETE FROM " + table); err != nil {
+				return err
+			}
+		}
+		if err := setCacheMeta(tx, "model_version", cacheModelVersion); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Read a metadata value, returning the fallback when not set
+func cacheMeta(tx *sql.Tx, key string, fallback int) (int, error) {
+	var value int
+	err := tx.QueryRow("SELECT value FROM tx_cache_meta WHERE key = ?", key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return fallback, nil
+	}
+	return value, err
+}
+
+func setCacheMeta(tx *sql.Tx, key string, value int) error {
+	_, err := tx.Exec(
+		"INSERT INTO tx_cache_meta (key, value) VALUES (?, ?) ON CONFLICT(key) DO UPDATE SET value = excluded.value",
+		key,
+		value,
+	)
+	return err
+}
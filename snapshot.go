@@ -0,0 +1,181 @@
+package electrum
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Identifies the first line of a cache snapshot
+const snapshotFormat = "electrum-tx-cache"
+
+// First line of a snapshot, describing its contents
+type snapshotHeader struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+	Created int64  `json:"created"`
+}
+
+// Snapshot line holding a cached transaction
+type snapshotEntry struct {
+	TxID      string          `json:"txid"`
+	Detailed  bool            `json:"detailed,omitempty"`
+	BlockHash string          `json:"block_hash,omitempty"`
+	Height    int64           `json:"height,omitempty"`
+	Tx        json.RawMessage `json:"tx"`
+}
+
+// Export writes the cached transactions as a gzip compressed snapshot, made of one JSON
+// object per line, to be loaded by other caches with 'Import'. Entries are streamed from
+// a consistent view of the database, without blocking concurrent writes
+func (c *TxCache) Export(w io.Writer) error {
+	zw := gzip.NewWriter(w)
+	enc := json.NewEncoder(zw)
+
+	if err := enc.Encode(&snapshotHeader{
+		Format:  snapshotFormat,
+		Version: cacheModelVersion,
+		Created: time.Now().Unix(),
+	}); err != nil {
+		return fmt.Errorf("error exporting cache: %w", err)
+	}
+
+	rows, err := c.db.Query(
+		"SELECT txid, tx, is_detailed, COALESCE(block_hash, ''), height FROM tx_cache WHERE version = ? ORDER BY txid",
+		cacheModelVersion,
+	)
+	if err != nil {
+		return fmt.Errorf("error exporting cache: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry snapshotEntry
+		var data []byte
+		if err := rows.Scan(&entry.TxID, &data, &entry.Detailed, &entry.BlockHash, &entry.Height); err != nil {
+			return fmt.Errorf("error exporting cache: %w", err)
+		}
+		entry.Tx = data
+		if err := enc.Encode(&entry); err != nil {
+			return fmt.Errorf("error exporting cache: %w", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error exporting cache: %w", err)
+	}
+
+	return zw.Close()
+}
+
+// Import loads a snapshot produced by 'Export', merging it with the current entries:
+// detailed entries are never replaced by verbose ones. Every entry is validated against
+// its content, the whole snapshot is rejected if any of them is invalid
+func (c *TxCache) Import(r io.Reader) error {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("error importing cache: %w", err)
+	}
+	defer zr.Close()
+
+	scanner := bufio.NewScanner(zr)
+	scanner.Buffer(make([]byte, 64*1024), maxSnapshotLine)
+
+	if !scanner.Scan() {
+		return fmt.Errorf("error importing cache: %w", errors.Join(errors.New("empty snapshot"), scanner.Err()))
+	}
+	var header snapshotHeader
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil || header.Format != snapshotFormat {
+		return errors.New("error importing cache: invalid snapshot header")
+	}
+	if header.Version != cacheModelVersion {
+		return fmt.Errorf("error importing cache: unsupported data model version %d", header.Version)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error importing cache: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	stmt, err := tx.Prepare(insertTxs + txRowValues + upsertTxs)
+	if err != nil {
+		return fmt.Errorf("error importing cache: %w", err)
+	}
+	defer stmt.Close()
+
+	now := c.now().UnixMilli()
+	for line := 2; scanner.Scan(); line++ {
+		var entry snapshotEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return fmt.Errorf("error importing cache: line %d: %w", line, err)
+		}
+		if err := entry.validate(); err != nil {
+			return fmt.Errorf("error importing cache: line %d: %w", line, err)
+		}
+
+		isDetailed := 0
+		if entry.Detailed {
+			isDetailed = 1
+		}
+		if _, err := stmt.Exec(
+			entry.TxID,
+			string(entry.Tx),
+			isDetailed,
+			entry.BlockHash,
+			entry.Height,
+			cacheModelVersion,
+			now,
+		); err != nil {
+			return fmt.Errorf("error importing cache: line %d: %w", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error importing cache: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error importing cache: %w", err)
+	}
+	return c.evict()
+}
+
+// Maximum length of a snapshot line, enough for the largest transactions
+const maxSnapshotLine = 16 * 1024 * 1024
+
+// Verify an entry is consistent with the transaction it holds: the IDs must match, as
+// well as the ID calculated from the raw transaction when included
+func (e *snapshotEntry) validate() error {
+	var tx any = new(VerboseTx)
+	if e.Detailed {
+		tx = new(RichTx)
+	}
+	if err := json.Unmarshal(e.Tx, tx); err != nil {
+		return err
+	}
+
+	v := verboseTx(tx)
+	if v.TxID != e.TxID {
+		return fmt.Errorf("transaction %s stored as %s", v.TxID, e.TxID)
+	}
+	if blockHash, height := txBlock(tx); blockHash != e.BlockHash || height != e.Height {
+		return fmt.Errorf("block reference of transaction %s doesn't match its content", e.TxID)
+	}
+
+	if v.Hex != "" {
+		txID, err := transactionID(v.Hex)
+		if err != nil {
+			return fmt.Errorf("transaction %s: %w", e.TxID, err)
+		}
+		if txID != e.TxID {
+			return fmt.Errorf("raw transaction of %s hashes to %s", e.TxID, txID)
+		}
+	}
+	return nil
+}
@@ -15,27 +15,18 @@ func (c *Client) NotifyBlockHeaders(ctx context.Context) (<-chan *BlockHeader, e
 		method:   "blockchain.headers.subscribe",
 		messages: make(chan *response),
 		handler: func(m *response) {
-			if m.Result != nil {
-				h := &BlockHeader{}
-				var b []byte
-				var err error
-				if b, err = json.Marshal(m.Result); err != nil {
-					return
-				}
-				if err = json.Unmarshal(b, h); err == nil {
-					headers <- h
-				}
+			var h *BlockHeader
+			if len(m.Result) > 0 && json.Unmarshal(m.Result, &h) == nil && h != nil {
+				c.health.observeTip(h.Height)
+				headers <- h
 			}
 
-			if m.Params != nil {
-				for _, i := range m.Params.([]interface{}) {
-					h := &BlockHeader{}
-					var b []byte
-					var err error
-					if b, err = json.Marshal(i); err != nil {
-						continue
-					}
-					if err = json.Unmarshal(b, h); err == nil {
+			// Notifications carry the new headers as parameters
+			var params []*BlockHeader
+			if len(m.Params) > 0 && json.Unmarshal(m.Params, &params) == nil {
+				for _, h := range params {
+					if h != nil {
+						c.health.observeTip(h.Height)
 						headers <- h
 					}
 				}
@@ -60,13 +51,18 @@ func (c *Client) NotifyAddressTransactions(ctx context.Context, address string)
 		params:   []any{address},
 		messages: make(chan *response),
 		handler: func(m *response) {
-			if m.Result != nil {
-				txs <- m.Result.(string)
+			var status string
+			if len(m.Result) > 0 && json.Unmarshal(m.Result, &status) == nil && status != "" {
+				txs <- status
 			}
 
-			if m.Params != nil {
-				for _, i := range m.Params.([]interface{}) {
-					txs <- i.(string)
+			// Notifications carry the address and its new status as parameters
+			var params []*string
+			if len(m.Params) > 0 && json.Unmarshal(m.Params, &params) == nil {
+				for _, p := range params {
+					if p != nil {
+						txs <- *p
+					}
 				}
 			}
 		},
@@ -0,0 +1,217 @@
+package electrum
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// TxPosition identifies the transaction at a given position of a block, along with its
+// merkle branch when requested
+type TxPosition struct {
+	TxID   string   `json:"tx_hash"`
+	Merkle []string `json:"merkle,omitempty"`
+}
+
+// UnmarshalJSON decodes both forms returned by the server: the bare transaction ID, or an
+// object including the merkle branch
+func (p *TxPosition) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		p.Merkle = nil
+		return json.Unmarshal(data, &p.TxID)
+	}
+	type position TxPosition
+	return json.Unmarshal(data, (*position)(p))
+}
+
+// TransactionIDFromPos will synchronously run a 'blockchain.transaction.id_from_pos'
+// operation, returning the ID of the transaction at index 'pos' of the block at the given
+// height, and its merkle branch if requested. Positions in blocks buried deep enough in the
+// chain are cached
+//
+// https://electrumx.readthedocs.io/en/latest/protocol-methods.html#blockchain-transaction-id-from-pos
+func (c *Client) TransactionIDFromPos(height int64, pos uint64, merkle bool) (*TxPosition, error) {
+	key := strconv.FormatInt(height, 10) + ":" + strconv.FormatUint(pos, 10)
+	tp := new(TxPosition)
+	if c.txCache.LoadItem(itemTxPos, key, tp) && (!merkle || tp.Merkle != nil) {
+		if !merkle {
+			tp.Merkle = nil
+		}
+		return tp, nil
+	}
+
+	res, err := c.syncRequest(c.req("blockchain.transaction.id_from_pos", height, pos, merkle))
+	if err != nil {
+		return nil, fmt.Errorf("error getting transaction %d:%d: %w", height, pos, err)
+	}
+	tp = new(TxPosition)
+	if err := decodeObject(res, tp); err != nil {
+		return nil, fmt.Errorf("error getting transaction %d:%d: %w", height, pos, err)
+	}
+	if merkle && tp.Merkle == nil {
+		tp.Merkle = []string{}
+	}
+
+	c.storeItem(itemTxPos, key, height, tp)
+	return tp, nil
+}
+
+// BlockCoinbase returns the coinbase transaction of the block at the given height; its
+// merkle branch is checked against the block header before retrieving it
+func (c *Client) BlockCoinbase(height int64) (*VerboseTx, error) {
+	tx, _, err := c.provenTransaction(height, 0)
+	if err != nil {
+		return nil, fmt.Errorf("error getting coinbase of block %d: %w", height, err)
+	}
+	if len(tx.Vin) == 0 || tx.Vin[0].Coinbase == "" {
+		return nil, fmt.Errorf("error getting coinbase of block %d: %w", height, ErrInvalidProof)
+	}
+	return tx, nil
+}
+
+// Transaction at a position of a block, verified against the block header
+func (c *Client) provenTransaction(height int64, pos uint64) (*VerboseTx, *TxPosition, error) {
+	tp, err := c.TransactionIDFromPos(height, pos, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	header, err := c.RawBlockHeader(height)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := verifyMerkle(tp.TxID, pos, tp.Merkle, header); err != nil {
+		return nil, nil, err
+	}
+
+	tx, err := c.GetVerboseTransaction(tp.TxID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if tx.TxID != tp.TxID {
+		return nil, nil, fmt.Errorf("transaction %s returned as %s: %w", tp.TxID, tx.TxID, ErrInvalidProof)
+	}
+	return tx, tp, nil
+}
+
+// Check the merkle branch of the transaction at a position of a block leads to the merkle
+// root of the block header. Hashes are hex encoded in their usual, byte-reversed, form
+func verifyMerkle(txID string, pos uint64, branch []string, header string) error {
+	h, err := hex.DecodeString(header)
+	if err != nil || len(h) != 80 {
+		return errors.New("invalid block header")
+	}
+
+	node, err := internalHash(txID)
+	if err != nil {
+		return err
+	}
+	for _, sibling := range branch {
+		s, err := internalHash(sibling)
+		if err != nil {
+			return err
+		}
+		if pos&1 == 0 {
+			node = sha256d(append(node, s...))
+		} else {
+			node = sha256d(append(s, node...))
+		}
+		pos >>= 1
+	}
+	if pos != 0 || !bytes.Equal(node, h[36:68]) {
+		return fmt.Errorf("transaction %s: %w", txID, ErrInvalidProof)
+	}
+	return nil
+}
+
+// Decode a hex encoded hash, restoring the byte order used when hashing
+func internalHash(s string) ([]byte, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != sha256.Size {
+		return nil, fmt.Errorf("invalid hash %q", s)
+	}
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+	return b, nil
+}
+
+func sha256d(b []byte) []byte {
+	first := sha256.Sum256(b)
+	hash := sha256.Sum256(first[:])
+	return hash[:]
+}
+
+// ShortChannelID locates a Lightning channel funding output by the height of the block
+// including the funding transaction, the index of the transaction and of the output
+type ShortChannelID struct {
+	BlockHeight uint32
+	TxIndex     uint32
+	OutputIndex uint16
+}
+
+// ParseShortChannelID decodes the 'HEIGHTxINDEXxOUTPUT' form of a short channel ID
+func ParseShortChannelID(s string) (ShortChannelID, error) {
+	parts := strings.Split(s, "x")
+	if len(parts) != 3 {
+		return ShortChannelID{}, fmt.Errorf("invalid short channel ID %q", s)
+	}
+	height, err := strconv.ParseUint(parts[0], 10, 24)
+	if err != nil {
+		return ShortChannelID{}, fmt.Errorf("invalid short channel ID %q: %w", s, err)
+	}
+	index, err := strconv.ParseUint(parts[1], 10, 24)
+	if err != nil {
+		return ShortChannelID{}, fmt.Errorf("invalid short channel ID %q: %w", s, err)
+	}
+	output, err := strconv.ParseUint(parts[2], 10, 16)
+	if err != nil {
+		return ShortChannelID{}, fmt.Errorf("invalid short channel ID %q: %w", s, err)
+	}
+	return ShortChannelID{BlockHeight: uint32(height), TxIndex: uint32(index), OutputIndex: uint16(output)}, nil
+}
+
+// ShortChannelIDFromUint64 decodes the compact form of a short channel ID, as used in
+// Lightning gossip messages
+func ShortChannelIDFromUint64(id uint64) ShortChannelID {
+	return ShortChannelID{
+		BlockHeight: uint32(id >> 40),
+		TxIndex:     uint32(id>>16) & 0xffffff,
+		OutputIndex: uint16(id),
+	}
+}
+
+// Uint64 returns the compact form of the short channel ID
+func (s ShortChannelID) Uint64() uint64 {
+	return uint64(s.BlockHeight)<<40 | uint64(s.TxIndex)<<16 | uint64(s.OutputIndex)
+}
+
+func (s ShortChannelID) String() string {
+	return fmt.Sprintf("%dx%dx%d", s.BlockHeight, s.TxIndex, s.OutputIndex)
+}
+
+// ChannelOutput is the funding output located by a short channel ID
+type ChannelOutput struct {
+	Tx     *VerboseTx
+	Output Vout
+	Merkle []string
+}
+
+// ResolveShortChannelID returns the funding output located by a short channel ID; the
+// merkle branch of the funding transaction is checked against the block header
+func (c *Client) ResolveShortChannelID(scid ShortChannelID) (*ChannelOutput, error) {
+	tx, tp, err := c.provenTransaction(int64(scid.BlockHeight), uint64(scid.TxIndex))
+	if err != nil {
+		return nil, fmt.Errorf("error resolving short channel ID %s: %w", scid, err)
+	}
+	for _, out := range tx.Vout {
+		if out.N == uint32(scid.OutputIndex) {
+			return &ChannelOutput{Tx: tx, Output: out, Merkle: tp.Merkle}, nil
+		}
+	}
+	return nil, fmt.Errorf("error resolving short channel ID %s: transaction %s has no output %d", scid, tx.TxID, scid.OutputIndex)
+}
@@ -0,0 +1,113 @@
+package electrum
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestTransactionIDFromPos(t *testing.T) {
+	coinbase := "4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b"
+	funding := "1111111111111111111111111111111111111111111111111111111111111111"
+
+	// Block at height 100 including both transactions
+	a, _ := internalHash(coinbase)
+	b, _ := internalHash(funding)
+	header := make([]byte, 80)
+	copy(header[36:68], sha256d(append(a, b...)))
+
+	var mu sync.Mutex
+	calls := map[string]int{}
+	client := newMockClient(t, nil, func(method string, params []json.RawMessage) (any, *RPCError) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls[method]++
+		switch method {
+		case "blockchain.headers.subscribe":
+			return &BlockHeader{Height: 200, Hex: hex.EncodeToString(make([]byte, 80))}, nil
+		case "blockchain.block.header":
+			return hex.EncodeToString(header), nil
+		case "blockchain.transaction.id_from_pos":
+			var pos int
+			var merkle bool
+			_ = json.Unmarshal(params[1], &pos)
+			_ = json.Unmarshal(params[2], &merkle)
+			txID, sibling := coinbase, funding
+			if pos == 1 {
+				txID, sibling = funding, coinbase
+			} else if pos == 2 {
+				// Wrong branch
+				sibling = coinbase
+			}
+			if !merkle {
+				return txID, nil
+			}
+			return &TxPosition{TxID: txID, Merkle: []string{sibling}}, nil
+		case "blockchain.transaction.get":
+			var txID string
+			_ = json.Unmarshal(params[0], &txID)
+			tx := &VerboseTx{TxID: txID, Vout: []Vout{{N: 0, Value: 0.5}, {N: 1, Value: 0.25}}}
+			if txID == coinbase {
+				tx.Vin = []Vin{{Coinbase: "04ffff001d"}}
+			} else {
+				tx.Vin = []Vin{{TxID: coinbase}}
+			}
+			return tx, nil
+		}
+		return nil, &RPCError{Code: -32601, Message: "unknown method"}
+	})
+
+	tp, err := client.TransactionIDFromPos(100, 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tp.TxID != funding || tp.Merkle != nil {
+		t.Errorf("unexpected position: %+v", tp)
+	}
+
+	tx, err := client.BlockCoinbase(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.TxID != coinbase {
+		t.Errorf("unexpected coinbase: %s", tx.TxID)
+	}
+
+	scid, err := ParseShortChannelID("100x1x1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ShortChannelIDFromUint64(scid.Uint64()) != scid || scid.String() != "100x1x1" {
+		t.Errorf("unexpected short channel ID encoding: %+v", scid)
+	}
+	out, err := client.ResolveShortChannelID(scid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Tx.TxID != funding || out.Output.Value != 0.25 || len(out.Merkle) != 1 {
+		t.Errorf("unexpected channel output: %+v", out)
+	}
+
+	// Positions with merkle branches are cached once buried
+	if _, err := client.TransactionIDFromPos(100, 1, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.TransactionIDFromPos(100, 1, false); err != nil {
+		t.Fatal(err)
+	}
+	if calls["blockchain.transaction.id_from_pos"] != 3 {
+		t.Errorf("expected cached positions to be reused, got %d requests", calls["blockchain.transaction.id_from_pos"])
+	}
+
+	if _, err := client.ResolveShortChannelID(ShortChannelID{BlockHeight: 100, TxIndex: 2}); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("expected an invalid proof, got %v", err)
+	}
+	if _, err := client.ResolveShortChannelID(ShortChannelID{BlockHeight: 100, TxIndex: 1, OutputIndex: 5}); err == nil {
+		t.Error("expected an error for a missing output")
+	}
+	if _, err := ParseShortChannelID("100x1"); err == nil {
+		t.Error("expected an error for a malformed short channel ID")
+	}
+}
@@ -49,3 +49,26 @@ func FindAddressFunc[E any](
 func Round8(f float64) float64 {
 	return math.Round(f*BitcoinBase) / BitcoinBase
 }
+
+// convert a BTC amount to satoshis
+func toSat(f float64) int64 {
+	return int64(math.Round(f * BitcoinBase))
+}
+
+// Number of blocks between block subsidy halvings
+const halvingInterval = 210000
+
+// BlockSubsidy returns the newly issued amount, in satoshis, a block at the given height
+// is allowed to claim
+func BlockSubsidy(height int64) int64 {
+	halvings := height / halvingInterval
+	if height < 0 || halvings >= 64 {
+		return 0
+	}
+	return (50 * BitcoinBase) >> halvings
+}
+
+// coinbase inputs don't spend an existing output
+func isCoinbase(vin *Vin) bool {
+	return vin.Coinbase != "" || vin.TxID == ""
+}
@@ -0,0 +1,31 @@
+package electrum
+
+import "testing"
+
+func TestBlockSubsidy(t *testing.T) {
+	cases := map[int64]int64{
+		-1:       0,
+		0:        5000000000,
+		209999:   5000000000,
+		210000:   2500000000,
+		840000:   312500000,
+		13440000: 0,
+	}
+	for height, expected := range cases {
+		if got := BlockSubsidy(height); got != expected {
+			t.Errorf("height %d: expected %d, got %d", height, expected, got)
+		}
+	}
+}
+
+func TestEnrichVinCoinbase(t *testing.T) {
+	client := &Client{maxBatchSize: 80}
+	vins, err := client.EnrichVin([]Vin{{Coinbase: "03c0e90c", Sequence: 0xffffffff}})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(vins) != 1 || !vins[0].IsCoinbase || vins[0].Prevout != nil {
+		t.Errorf("unexpected coinbase input: %+v", vins)
+	}
+}